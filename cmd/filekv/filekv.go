@@ -11,6 +11,17 @@ import (
 )
 
 func main() {
+	if len(os.Args) > 1 {
+		if err := runSetOperation(os.Args[1], os.Args[2:]); err != nil {
+			log.Fatal(err)
+		}
+		return
+	}
+	demo()
+}
+
+// demo merges overlapping lists and checks the deduplicated count
+func demo() {
 	// create 4 lists
 	// two on disk
 	list1, list2, list3 := "list1.txt", "list2.txt", "list3.txt"
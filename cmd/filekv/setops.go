@@ -0,0 +1,102 @@
+package main
+
+import (
+	"bufio"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/projectdiscovery/hmap/filekv"
+)
+
+var strategies = map[string]filekv.Strategy{
+	"map":    filekv.MemoryMap,
+	"filter": filekv.MemoryFilter,
+	"disk":   filekv.DiskFilter,
+	"sort":   filekv.ExternalSort,
+}
+
+// runSetOperation runs the union, intersect, diff and symdiff subcommands:
+//
+//	filekv diff -o new.txt current.txt previous.txt
+//
+// Lists hold one item per line, "-" reads stdin. Without -o the items are printed
+func runSetOperation(name string, args []string) error {
+	flags := flag.NewFlagSet(name, flag.ExitOnError)
+	output := flags.String("o", "", "output file, stdout if empty")
+	dedupe := flags.String("dedupe", "disk", "dedupe strategy (map, filter, disk, sort)")
+	sorted := flags.Bool("sorted", false, "sort the output of the sort strategy")
+	flags.Usage = func() {
+		fmt.Fprintf(flags.Output(), "Usage: filekv union|intersect|diff|symdiff [flags] list...\n")
+		flags.PrintDefaults()
+	}
+	_ = flags.Parse(args)
+
+	minLists := map[string]int{"union": 1, "intersect": 2, "diff": 2, "symdiff": 2}[name]
+	if minLists == 0 || flags.NArg() < minLists || (name == "symdiff" && flags.NArg() != 2) {
+		flags.Usage()
+		os.Exit(2)
+	}
+	strategy, ok := strategies[*dedupe]
+	if !ok {
+		return fmt.Errorf("unknown dedupe strategy %q", *dedupe)
+	}
+	lists := make([]interface{}, flags.NArg())
+	for i, list := range flags.Args() {
+		if list == "-" {
+			lists[i] = os.Stdin
+		} else {
+			lists[i] = list
+		}
+	}
+
+	// the result db is written to a temporary folder and its keys copied to the output
+	dir, err := os.MkdirTemp("", "filekv")
+	if err != nil {
+		return err
+	}
+	defer os.RemoveAll(dir)
+	options := filekv.DefaultOptions
+	options.Dedupe = strategy
+	options.SortedOutput = *sorted
+	options.Path = filepath.Join(dir, "output")
+
+	var fdb *filekv.FileDB
+	switch name {
+	case "union":
+		fdb, err = filekv.Union(options, lists...)
+	case "intersect":
+		fdb, err = filekv.Intersection(options, lists[0], lists[1:]...)
+	case "diff":
+		fdb, err = filekv.Difference(options, lists[0], lists[1:]...)
+	case "symdiff":
+		fdb, err = filekv.SymmetricDifference(options, lists[0], lists[1])
+	}
+	if err != nil {
+		return err
+	}
+	defer fdb.Close()
+
+	out := os.Stdout
+	if *output != "" {
+		if out, err = os.Create(*output); err != nil {
+			return err
+		}
+		defer out.Close()
+	}
+	w := bufio.NewWriter(out)
+	if err := fdb.Scan(func(k, _ []byte) error {
+		_, err := fmt.Fprintf(w, "%s\n", k)
+		return err
+	}); err != nil {
+		return err
+	}
+	if err := w.Flush(); err != nil {
+		return err
+	}
+	if out != os.Stdout {
+		return out.Close()
+	}
+	return nil
+}
@@ -3,6 +3,11 @@ package filekv
 import "errors"
 
 var (
-	ErrItemExists   = errors.New("item already exist")
-	ErrItemFiltered = errors.New("item filtered")
+	ErrItemExists        = errors.New("item already exist")
+	ErrItemFiltered      = errors.New("item filtered")
+	ErrSinkClosed        = errors.New("sink closed")
+	ErrNotStreaming      = errors.New("db not in streaming mode")
+	ErrStreamingStrategy = errors.New("strategy not supported in streaming mode")
+	ErrUnsupportedSource = errors.New("unsupported source")
+	ErrSetStrategy       = errors.New("strategy not supported by set operations")
 )
@@ -31,12 +31,22 @@ type FileDB struct {
 	bdb     *bloom.BloomFilter           // bloom filter
 	ddb     *leveldb.DB                  // disk based filter
 	ddbName string
+	// filterFresh is set when the persisted filter matches the resumed db, filterLoaded
+	// once it has been loaded
+	filterFresh  bool
+	filterLoaded bool
+
+	observer observer
 
 	sync.RWMutex
 }
 
 // Open a new file based db
 func Open(options Options) (*FileDB, error) {
+	if options.Streaming && options.Dedupe == ExternalSort {
+		return nil, ErrStreamingStrategy
+	}
+
 	db, err := os.OpenFile(options.Path, os.O_RDWR|os.O_CREATE|os.O_APPEND, permissionutil.ConfigFilePermission)
 	if err != nil {
 		return nil, err
@@ -66,11 +76,36 @@ func Open(options Options) (*FileDB, error) {
 		fdb.dbWriter = fdb.db
 	}
 
+	if options.Resume {
+		if err := fdb.resume(); err != nil {
+			return nil, err
+		}
+	}
+
+	if options.Streaming {
+		maxItems := MaxItems
+		if options.MaxItems > 0 {
+			maxItems = options.MaxItems
+		}
+		if err := fdb.openFilter(maxItems + fdb.stats.NumberOfItems); err != nil {
+			return nil, err
+		}
+	}
+
 	return fdb, nil
 }
 
 // Process added files/slices/elements
 func (fdb *FileDB) Process() error {
+	defer fdb.track(OpProcess)()
+
+	fdb.Lock()
+	defer fdb.Unlock()
+
+	if fdb.options.Streaming {
+		return fdb.endStream()
+	}
+
 	// Closes the temporary file
 	if fdb.options.Compress {
 		// close the writer
@@ -96,8 +131,69 @@ func (fdb *FileDB) Process() error {
 	default:
 		maxItems = MaxItems
 	}
+	// resumed items are seeded in the filter
+	maxItems += fdb.stats.NumberOfItems
 
 	// size the filter according to the number of input items
+	if err := fdb.openFilter(maxItems); err != nil {
+		return err
+	}
+
+	var tmpDbReader io.Reader
+	if fdb.options.Compress {
+		var err error
+		tmpDbReader, err = zlib.NewReader(fdb.tmpDb)
+		if err != nil {
+			return err
+		}
+	} else {
+		tmpDbReader = fdb.tmpDb
+	}
+
+	if fdb.options.Dedupe == ExternalSort {
+		if err := fdb.externalSort(tmpDbReader); err != nil {
+			return err
+		}
+	} else {
+		sc := bufio.NewScanner(tmpDbReader)
+		buf := make([]byte, BufferSize)
+		sc.Buffer(buf, BufferSize)
+		for sc.Scan() {
+			_ = fdb.dedupeAndSet(sc.Bytes(), nil)
+		}
+	}
+
+	fdb.tmpDb.Close()
+
+	// flush to disk
+	fdb.dbWriter.Close()
+	fdb.db.Close()
+
+	return fdb.closeFilter()
+}
+
+// openFilter creates the dedupe filter sized for maxItems, seeding it with the items of the
+// resumed db unless a persisted filter is up to date
+func (fdb *FileDB) openFilter(maxItems uint) error {
+	if fdb.persistentFilter() {
+		if err := fdb.openPersistentFilter(maxItems); err != nil {
+			return err
+		}
+	} else if err := fdb.createFilter(maxItems); err != nil {
+		return err
+	}
+	if fdb.options.Resume && !fdb.filterLoaded && fdb.options.Dedupe != ExternalSort {
+		return fdb.Scan(func(k, _ []byte) error {
+			fdb.seen(k)
+			return nil
+		})
+	}
+	return nil
+}
+
+// createFilter creates an empty dedupe filter sized for maxItems
+func (fdb *FileDB) createFilter(maxItems uint) error {
+	var err error
 	switch fdb.options.Dedupe {
 	case MemoryMap:
 		fdb.mapdb = make(map[string]struct{}, maxItems)
@@ -119,32 +215,14 @@ func (fdb *FileDB) Process() error {
 			return err
 		}
 	}
+	return nil
+}
 
-	var tmpDbReader io.Reader
-	if fdb.options.Compress {
-		var err error
-		tmpDbReader, err = zlib.NewReader(fdb.tmpDb)
-		if err != nil {
-			return err
-		}
-	} else {
-		tmpDbReader = fdb.tmpDb
-	}
-
-	sc := bufio.NewScanner(tmpDbReader)
-	buf := make([]byte, BufferSize)
-	sc.Buffer(buf, BufferSize)
-	for sc.Scan() {
-		_ = fdb.Set(sc.Bytes(), nil)
+// closeFilter releases the dedupe filter, persisting it if requested
+func (fdb *FileDB) closeFilter() error {
+	if fdb.persistentFilter() {
+		return fdb.closePersistentFilter()
 	}
-
-	fdb.tmpDb.Close()
-
-	// flush to disk
-	fdb.dbWriter.Close()
-	fdb.db.Close()
-
-	// cleanup filters
 	switch fdb.options.Dedupe {
 	case MemoryMap:
 		fdb.mapdb = nil
@@ -156,12 +234,14 @@ func (fdb *FileDB) Process() error {
 		fdb.ddb.Close()
 		os.RemoveAll(fdb.ddbName)
 	}
-
 	return nil
 }
 
 // Reset the db
 func (fdb *FileDB) Reset() error {
+	fdb.Lock()
+	defer fdb.Unlock()
+
 	// clear the cache
 	switch fdb.options.Dedupe {
 	case MemoryMap:
@@ -209,6 +289,8 @@ func (fdb *FileDB) Reset() error {
 
 // Size - returns the size of the database in bytes
 func (fdb *FileDB) Size() int64 {
+	fdb.RLock()
+	defer fdb.RUnlock()
 	osstat, err := fdb.db.Stat()
 	if err != nil {
 		return 0
@@ -216,8 +298,18 @@ func (fdb *FileDB) Size() int64 {
 	return osstat.Size()
 }
 
+// Stats - returns the counters of the db
+func (fdb *FileDB) Stats() Stats {
+	fdb.RLock()
+	defer fdb.RUnlock()
+	return fdb.stats
+}
+
 // Close ...
 func (fdb *FileDB) Close() {
+	fdb.Lock()
+	defer fdb.Unlock()
+
 	tmpDBFilename := fdb.tmpDb.Name()
 	_ = fdb.tmpDb.Close()
 	os.RemoveAll(tmpDBFilename)
@@ -230,7 +322,9 @@ func (fdb *FileDB) Close() {
 
 	if fdb.ddbName != "" {
 		fdb.ddb.Close()
-		os.RemoveAll(fdb.ddbName)
+		if !fdb.persistentFilter() {
+			os.RemoveAll(fdb.ddbName)
+		}
 	}
 }
 
@@ -248,40 +342,68 @@ func (fdb *FileDB) set(k, v []byte) error {
 	return nil
 }
 
-func (fdb *FileDB) Set(k, v []byte) error {
-	// check for duplicates
+// seen returns true if k was already added to the dedupe filter, adding it otherwise
+func (fdb *FileDB) seen(k []byte) bool {
 	switch fdb.options.Dedupe {
 	case MemoryMap:
 		if _, ok := fdb.mapdb[string(k)]; ok {
-			fdb.stats.NumberOfDupedItems++
-			return ErrItemExists
+			return true
 		}
 		fdb.mapdb[string(k)] = struct{}{}
 	case MemoryLRU:
-		if ok, _ := fdb.mdb.ContainsOrAdd(string(k), struct{}{}); ok {
-			fdb.stats.NumberOfDupedItems++
-			return ErrItemExists
-		}
+		ok, _ := fdb.mdb.ContainsOrAdd(string(k), struct{}{})
+		return ok
 	case MemoryFilter:
-		if ok := fdb.bdb.TestOrAdd(k); ok {
-			fdb.stats.NumberOfDupedItems++
-			return ErrItemExists
-		}
+		return fdb.bdb.TestOrAdd(k)
 	case DiskFilter:
-		if ok, err := fdb.ddb.Has(k, nil); err == nil && ok {
-			fdb.stats.NumberOfDupedItems++
-			return ErrItemExists
-		} else if err == nil && !ok {
+		ok, err := fdb.ddb.Has(k, nil)
+		if err == nil && ok {
+			return true
+		} else if err == nil {
 			_ = fdb.ddb.Put(k, []byte{}, nil)
 		}
 	}
+	return false
+}
+
+// has returns true if k was added to the dedupe filter
+func (fdb *FileDB) has(k []byte) bool {
+	switch fdb.options.Dedupe {
+	case MemoryMap:
+		_, ok := fdb.mapdb[string(k)]
+		return ok
+	case MemoryLRU:
+		return fdb.mdb.Contains(string(k))
+	case MemoryFilter:
+		return fdb.bdb.Test(k)
+	case DiskFilter:
+		ok, err := fdb.ddb.Has(k, nil)
+		return err == nil && ok
+	}
+	return false
+}
+
+// Set - writes an item to the db unless it's a duplicate or filtered, it's safe for concurrent use
+func (fdb *FileDB) Set(k, v []byte) error {
+	defer fdb.track(OpSet)()
+
+	fdb.Lock()
+	defer fdb.Unlock()
+	return fdb.dedupeAndSet(k, v)
+}
+
+func (fdb *FileDB) dedupeAndSet(k, v []byte) error {
+	// check for duplicates
+	if fdb.seen(k) {
+		fdb.stats.NumberOfDupedItems++
+		return ErrItemExists
+	}
 
 	if fdb.shouldSkip(k, v) {
 		fdb.stats.NumberOfFilteredItems++
 		return ErrItemFiltered
 	}
 
-	fdb.stats.NumberOfItems++
 	return fdb.set(k, v)
 }
 
@@ -294,14 +416,13 @@ func (fdb *FileDB) Scan(handler func([]byte, []byte) error) error {
 	}
 	defer dbCopy.Close()
 
-	var dbReader io.ReadCloser
+	var dbReader io.Reader = dbCopy
 	if fdb.options.Compress {
-		dbReader, err = zlib.NewReader(dbCopy)
+		// appending to a compressed db adds a zlib stream
+		dbReader, err = newMultiStreamReader(dbCopy)
 		if err != nil {
 			return err
 		}
-	} else {
-		dbReader = dbCopy
 	}
 
 	sc := bufio.NewScanner(dbReader)
@@ -1,9 +1,13 @@
 package filekv
 
 import (
+	"errors"
+	"fmt"
 	"os"
 	"path/filepath"
+	"slices"
 	"strings"
+	"sync"
 	"testing"
 
 	"github.com/rs/xid"
@@ -64,3 +68,386 @@ func TestFile(t *testing.T) {
 		t.Errorf("wrong number of items: wanted %d, got %d\n", expected, count)
 	}
 }
+
+func TestExternalSort(t *testing.T) {
+	// 3 overlapping lists in decreasing order
+	var lists [][]string
+	for l := 0; l < 3; l++ {
+		var list []string
+		for i := 3000; i > 0; i-- {
+			list = append(list, fmt.Sprintf("%05d", l*1000+i))
+		}
+		lists = append(lists, list)
+	}
+	var firstSeen []string
+	seen := make(map[string]struct{})
+	for _, list := range lists {
+		for _, item := range list {
+			if _, ok := seen[item]; !ok {
+				seen[item] = struct{}{}
+				firstSeen = append(firstSeen, item)
+			}
+		}
+	}
+	sorted := slices.Clone(firstSeen)
+	slices.Sort(sorted)
+
+	for _, compress := range []bool{false, true} {
+		for _, sortedOutput := range []bool{false, true} {
+			options := DefaultOptions
+			options.Path = filepath.Join(t.TempDir(), xid.New().String())
+			options.Dedupe = ExternalSort
+			options.Compress = compress
+			options.SortedOutput = sortedOutput
+			// force several runs
+			options.SortChunkSize = 4096
+			fdb, err := Open(options)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if _, err := fdb.Merge(lists[0], lists[1], lists[2]); err != nil {
+				t.Fatal(err)
+			}
+			if err := fdb.Process(); err != nil {
+				t.Fatal(err)
+			}
+
+			var items []string
+			if err := fdb.Scan(func(k, v []byte) error {
+				items = append(items, string(k))
+				return nil
+			}); err != nil {
+				t.Fatal(err)
+			}
+			expected := firstSeen
+			if sortedOutput {
+				expected = sorted
+			}
+			if !slices.Equal(expected, items) {
+				t.Errorf("compress=%v sorted=%v: unexpected items, got %d wanted %d", compress, sortedOutput, len(items), len(expected))
+			}
+			stats := fdb.Stats()
+			if stats.NumberOfDupedItems != uint(9000-len(expected)) || stats.NumberOfItems != uint(len(expected)) {
+				t.Errorf("compress=%v sorted=%v: unexpected stats %+v", compress, sortedOutput, stats)
+			}
+			fdb.Close()
+		}
+	}
+}
+
+func TestConcurrentProducers(t *testing.T) {
+	options := DefaultOptions
+	options.Path = filepath.Join(t.TempDir(), xid.New().String())
+	options.Dedupe = MemoryMap
+	fdb, err := Open(options)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer fdb.Close()
+
+	const producers, n = 8, 1000
+	sink := fdb.NewSink(64)
+	var wg sync.WaitGroup
+	for p := 0; p < producers; p++ {
+		wg.Add(1)
+		go func(p int) {
+			defer wg.Done()
+			for i := 0; i < n; i++ {
+				item := fmt.Sprintf("%d-%d", p, i)
+				var err error
+				switch i % 4 {
+				case 0:
+					_, err = fdb.Merge([]string{item})
+				case 1:
+					_, err = fdb.MergeReader(strings.NewReader(item + NewLine))
+				case 2:
+					err = sink.Add([]byte(item))
+				case 3:
+					_, err = fmt.Fprintln(sink, item)
+				}
+				if err != nil {
+					t.Error(err)
+				}
+				_ = fdb.Stats()
+			}
+		}(p)
+	}
+	wg.Wait()
+	if count, err := sink.Close(); err != nil || count != producers*n/2 {
+		t.Fatalf("unexpected sink result: %d %v", count, err)
+	}
+	if err := sink.Add([]byte("late")); err != ErrSinkClosed {
+		t.Errorf("unexpected error %v", err)
+	}
+	if err := fdb.Process(); err != nil {
+		t.Fatal(err)
+	}
+
+	seen := make(map[string]struct{})
+	if err := fdb.Scan(func(k, v []byte) error {
+		seen[string(k)] = struct{}{}
+		return nil
+	}); err != nil {
+		t.Fatal(err)
+	}
+	if len(seen) != producers*n {
+		t.Errorf("wrong number of items: wanted %d, got %d", producers*n, len(seen))
+	}
+}
+
+func TestStreaming(t *testing.T) {
+	options := DefaultOptions
+	options.Path = filepath.Join(t.TempDir(), xid.New().String())
+	options.Streaming = true
+	options.Dedupe = ExternalSort
+	if _, err := Open(options); err != ErrStreamingStrategy {
+		t.Fatalf("unexpected error %v", err)
+	}
+
+	options.Dedupe = MemoryMap
+	unique := make(chan string, 16)
+	options.OnItem = func(k, v []byte) {
+		unique <- string(k)
+	}
+	fdb, err := Open(options)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer fdb.Close()
+
+	if err := fdb.Add([]byte("a"), nil); err != nil {
+		t.Fatal(err)
+	}
+	// the item is visible right away
+	if item := <-unique; item != "a" {
+		t.Errorf("unexpected item %s", item)
+	}
+	if n := len(slices.Collect(fdb.Keys())); n != 1 {
+		t.Errorf("wrong number of items: wanted 1, got %d", n)
+	}
+	if err := fdb.Add([]byte("a"), nil); err != ErrItemExists {
+		t.Errorf("unexpected error %v", err)
+	}
+	if err := fdb.Add(nil, nil); err != ErrItemFiltered {
+		t.Errorf("unexpected error %v", err)
+	}
+	if _, err := fdb.Merge([]string{"a", "b", "c"}, strings.NewReader("c\nd\n")); err != nil {
+		t.Fatal(err)
+	}
+	for _, expected := range []string{"b", "c", "d"} {
+		if item := <-unique; item != expected {
+			t.Errorf("unexpected item %s, wanted %s", item, expected)
+		}
+	}
+	if err := fdb.Process(); err != nil {
+		t.Fatal(err)
+	}
+
+	var items []string
+	if err := fdb.Scan(func(k, v []byte) error {
+		items = append(items, string(k))
+		return nil
+	}); err != nil {
+		t.Fatal(err)
+	}
+	if !slices.Equal([]string{"a", "b", "c", "d"}, items) {
+		t.Errorf("unexpected items %v", items)
+	}
+	stats := fdb.Stats()
+	if stats.NumberOfAddedItems != 8 || stats.NumberOfDupedItems != 3 || stats.NumberOfFilteredItems != 1 {
+		t.Errorf("unexpected stats %+v", stats)
+	}
+
+	staged := DefaultOptions
+	staged.Path = filepath.Join(t.TempDir(), xid.New().String())
+	sfdb, err := Open(staged)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer sfdb.Close()
+	if err := sfdb.Add([]byte("a"), nil); err != ErrNotStreaming {
+		t.Errorf("unexpected error %v", err)
+	}
+}
+
+func TestResume(t *testing.T) {
+	run := func(options Options, items []string) *FileDB {
+		fdb, err := Open(options)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := fdb.Merge(items); err != nil {
+			t.Fatal(err)
+		}
+		if err := fdb.Process(); err != nil {
+			t.Fatal(err)
+		}
+		return fdb
+	}
+	keys := func(fdb *FileDB) []string {
+		var keys []string
+		if err := fdb.Scan(func(k, v []byte) error {
+			keys = append(keys, string(k))
+			return nil
+		}); err != nil {
+			t.Fatal(err)
+		}
+		return keys
+	}
+
+	strategies := map[string]Options{
+		"map":             {Dedupe: MemoryMap},
+		"filter":          {Dedupe: MemoryFilter},
+		"disk":            {Dedupe: DiskFilter},
+		"sort":            {Dedupe: ExternalSort, SortChunkSize: 64},
+		"persist-filter":  {Dedupe: MemoryFilter, PersistFilter: true},
+		"persist-disk":    {Dedupe: DiskFilter, PersistFilter: true},
+		"stream-map":      {Dedupe: MemoryMap, Streaming: true},
+		"stream-persist":  {Dedupe: DiskFilter, Streaming: true, PersistFilter: true},
+		"compressed-map":  {Dedupe: MemoryMap, Compress: true},
+		"compressed-sort": {Dedupe: ExternalSort, Compress: true},
+	}
+	for name, options := range strategies {
+		t.Run(name, func(t *testing.T) {
+			options.Path = filepath.Join(t.TempDir(), "out")
+			options.SkipEmpty = true
+			options.Resume = true
+
+			run(options, []string{"a", "b", "c"}).Close()
+			second := run(options, []string{"c", "d", "a", "e"})
+			if stats := second.Stats(); stats.NumberOfItems != 5 || stats.NumberOfDupedItems != 2 {
+				t.Errorf("unexpected stats %+v", stats)
+			}
+			second.Close()
+
+			third := run(options, []string{"e", "f"})
+			defer third.Close()
+			if options.PersistFilter && !third.filterLoaded {
+				t.Error("the persisted filter wasn't loaded")
+			}
+			if items := keys(third); !slices.Equal([]string{"a", "b", "c", "d", "e", "f"}, items) {
+				t.Errorf("unexpected items %v", items)
+			}
+			if stats := third.Stats(); stats.NumberOfItems != 6 || stats.NumberOfDupedItems != 1 {
+				t.Errorf("unexpected stats %+v", stats)
+			}
+			if !options.PersistFilter {
+				return
+			}
+			third.Close()
+
+			// a persisted filter out of sync with the db is rebuilt
+			f, err := os.OpenFile(options.Path, os.O_APPEND|os.O_WRONLY, 0o600)
+			if err != nil {
+				t.Fatal(err)
+			}
+			_, _ = f.WriteString("g" + Separator + NewLine)
+			f.Close()
+			fourth := run(options, []string{"g"})
+			defer fourth.Close()
+			if fourth.filterLoaded || fourth.Stats().NumberOfDupedItems != 1 {
+				t.Errorf("unexpected stats %+v", fourth.Stats())
+			}
+		})
+	}
+}
+
+func TestSetOperations(t *testing.T) {
+	previous := []string{"a", "b", "c", "c", "d"}
+	current := "b\nd\ne\nf\ne\n"
+	expected := map[string][]string{
+		"union":        {"a", "b", "c", "d", "e", "f"},
+		"intersection": {"b", "d"},
+		"difference":   {"e", "f"},
+		"symmetric":    {"a", "c", "e", "f"},
+	}
+
+	for _, strategy := range []Strategy{MemoryMap, DiskFilter, ExternalSort} {
+		for _, streaming := range []bool{false, true} {
+			if streaming && strategy == ExternalSort {
+				continue
+			}
+			options := DefaultOptions
+			options.Dedupe = strategy
+			options.Streaming = streaming
+
+			// the previous run as a db
+			prevOptions := options
+			prevOptions.Path = filepath.Join(t.TempDir(), "previous")
+			prev, err := Union(prevOptions, previous)
+			if err != nil {
+				t.Fatal(err)
+			}
+			currentFile := filepath.Join(t.TempDir(), "current")
+			if err := os.WriteFile(currentFile, []byte(current), 0o600); err != nil {
+				t.Fatal(err)
+			}
+
+			for op, compute := range map[string]func(Options) (*FileDB, error){
+				"union": func(o Options) (*FileDB, error) {
+					return Union(o, prev, strings.NewReader(current))
+				},
+				"intersection": func(o Options) (*FileDB, error) {
+					return Intersection(o, currentFile, prev)
+				},
+				"difference": func(o Options) (*FileDB, error) {
+					return Difference(o, strings.NewReader(current), prev, []string{"x"})
+				},
+				"symmetric": func(o Options) (*FileDB, error) {
+					return SymmetricDifference(o, prev, strings.NewReader(current))
+				},
+			} {
+				options.Path = filepath.Join(t.TempDir(), op)
+				out, err := compute(options)
+				if err != nil {
+					t.Fatal(err)
+				}
+				items := slices.Sorted(func(yield func(string) bool) {
+					for k := range out.Keys() {
+						if !yield(string(k)) {
+							return
+						}
+					}
+				})
+				if !slices.Equal(expected[op], items) {
+					t.Errorf("strategy %d streaming %v %s: unexpected items %v", strategy, streaming, op, items)
+				}
+				out.Close()
+			}
+			prev.Close()
+		}
+	}
+
+	options := DefaultOptions
+	options.Path = filepath.Join(t.TempDir(), "unsupported")
+	if _, err := Union(options, 42); !errors.Is(err, ErrUnsupportedSource) {
+		t.Errorf("unexpected error %v", err)
+	}
+
+	// None would keep the duplicates
+	options.Dedupe = None
+	options.Path = filepath.Join(t.TempDir(), "none")
+	if _, err := Union(options, previous); !errors.Is(err, ErrSetStrategy) {
+		t.Errorf("unexpected error %v", err)
+	}
+
+	// MemoryLRU would forget the evicted items
+	options.Dedupe = MemoryLRU
+	options.MaxItems = 1
+	options.Path = filepath.Join(t.TempDir(), "lru")
+	out, err := Difference(options, strings.NewReader(current+"a\nb\n"), previous)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer out.Close()
+	items := slices.Sorted(func(yield func(string) bool) {
+		for k := range out.Keys() {
+			if !yield(string(k)) {
+				return
+			}
+		}
+	})
+	if !slices.Equal(expected["difference"], items) {
+		t.Errorf("lru: unexpected items %v", items)
+	}
+}
@@ -0,0 +1,41 @@
+package filekv
+
+import (
+	"bytes"
+	"errors"
+	"iter"
+)
+
+var errStopIteration = errors.New("stop iteration")
+
+// All - returns an iterator over the items of the db file. Read errors end the iteration,
+// use Scan to handle them
+func (fdb *FileDB) All() iter.Seq2[[]byte, []byte] {
+	return fdb.Prefix("")
+}
+
+// Keys - returns an iterator over the keys of the db file
+func (fdb *FileDB) Keys() iter.Seq[[]byte] {
+	return func(yield func([]byte) bool) {
+		for k := range fdb.All() {
+			if !yield(k) {
+				return
+			}
+		}
+	}
+}
+
+// Prefix - returns an iterator over the items of the db file whose key starts with p
+func (fdb *FileDB) Prefix(p string) iter.Seq2[[]byte, []byte] {
+	return func(yield func([]byte, []byte) bool) {
+		_ = fdb.Scan(func(k, v []byte) error {
+			if !bytes.HasPrefix(k, []byte(p)) {
+				return nil
+			}
+			if !yield(k, v) {
+				return errStopIteration
+			}
+			return nil
+		})
+	}
+}
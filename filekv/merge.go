@@ -7,30 +7,29 @@ import (
 	"os"
 )
 
+// mergeBatchSize is the amount of data MergeReader buffers before writing it under the lock
+const mergeBatchSize = 64 * 1024
+
+// Merge - adds the items of slices, readers and files to the temporary file, it's safe for
+// concurrent use and the items of a call are never interleaved within a line
 func (f *FileDB) Merge(items ...interface{}) (uint, error) {
+	defer f.track(OpMerge)()
+
 	var count uint
 	for _, item := range items {
 		switch itemData := item.(type) {
 		case [][]byte:
-			for _, data := range itemData {
-				if _, err := f.tmpDbWriter.Write(data); err != nil {
-					return 0, err
-				}
-				if _, err := f.tmpDbWriter.Write([]byte(NewLine)); err != nil {
-					return 0, err
-				}
-				count++
-				f.stats.NumberOfAddedItems++
+			c, err := f.mergeLines(len(itemData), func(i int) []byte { return itemData[i] })
+			if err != nil {
+				return 0, err
 			}
+			count += c
 		case []string:
-			for _, data := range itemData {
-				_, err := f.tmpDbWriter.Write([]byte(data + NewLine))
-				if err != nil {
-					return 0, err
-				}
-				count++
-				f.stats.NumberOfAddedItems++
+			c, err := f.mergeLines(len(itemData), func(i int) []byte { return []byte(itemData[i]) })
+			if err != nil {
+				return 0, err
 			}
+			count += c
 		case io.Reader:
 			c, err := f.MergeReader(itemData)
 			if err != nil {
@@ -48,6 +47,46 @@ func (f *FileDB) Merge(items ...interface{}) (uint, error) {
 	return count, nil
 }
 
+// mergeLines writes n lines to the temporary file under the lock
+func (f *FileDB) mergeLines(n int, line func(i int) []byte) (uint, error) {
+	if f.options.Streaming {
+		for i := 0; i < n; i++ {
+			if err := f.addLine(line(i)); err != nil {
+				return uint(i), err
+			}
+		}
+		return uint(n), nil
+	}
+
+	f.Lock()
+	defer f.Unlock()
+
+	var count uint
+	for i := 0; i < n; i++ {
+		if _, err := f.tmpDbWriter.Write(line(i)); err != nil {
+			return count, err
+		}
+		if _, err := f.tmpDbWriter.Write([]byte(NewLine)); err != nil {
+			return count, err
+		}
+		count++
+		f.stats.NumberOfAddedItems++
+	}
+	return count, nil
+}
+
+// writeLines writes a buffer of count newline terminated items to the temporary file
+func (f *FileDB) writeLines(b []byte, count uint) error {
+	f.Lock()
+	defer f.Unlock()
+
+	if _, err := f.tmpDbWriter.Write(b); err != nil {
+		return err
+	}
+	f.stats.NumberOfAddedItems += count
+	return nil
+}
+
 func (f *FileDB) shouldSkip(k, v []byte) bool {
 	if f.options.SkipEmpty && len(k) == 0 {
 		return true
@@ -70,21 +109,40 @@ func (f *FileDB) MergeFile(filename string) (uint, error) {
 	return f.MergeReader(newF)
 }
 
+// MergeReader - adds the lines of reader to the temporary file. Lines are read without
+// holding the lock and written in batches
 func (f *FileDB) MergeReader(reader io.Reader) (uint, error) {
-	var count uint
+	var count, pending uint
 	sc := bufio.NewScanner(reader)
-	buf := make([]byte, BufferSize)
-	sc.Buffer(buf, BufferSize)
-	var itemToWrite bytes.Buffer
+	// grow the buffer on demand, as merges can be frequent and small
+	sc.Buffer(make([]byte, 0, mergeBatchSize), BufferSize)
+	var itemsToWrite bytes.Buffer
 	for sc.Scan() {
-		itemToWrite.Write(sc.Bytes())
-		itemToWrite.WriteString(NewLine)
-		if _, err := f.tmpDbWriter.Write(itemToWrite.Bytes()); err != nil {
+		if f.options.Streaming {
+			if err := f.addLine(sc.Bytes()); err != nil {
+				return 0, err
+			}
+			count++
+			continue
+		}
+		itemsToWrite.Write(sc.Bytes())
+		itemsToWrite.WriteString(NewLine)
+		pending++
+		if itemsToWrite.Len() < mergeBatchSize {
+			continue
+		}
+		if err := f.writeLines(itemsToWrite.Bytes(), pending); err != nil {
 			return 0, err
 		}
-		itemToWrite.Reset()
-		count++
-		f.stats.NumberOfAddedItems++
+		count += pending
+		pending = 0
+		itemsToWrite.Reset()
+	}
+	if pending > 0 {
+		if err := f.writeLines(itemsToWrite.Bytes(), pending); err != nil {
+			return 0, err
+		}
+		count += pending
 	}
 	return count, nil
 }
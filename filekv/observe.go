@@ -0,0 +1,42 @@
+package filekv
+
+import (
+	"sync/atomic"
+	"time"
+)
+
+// Operations reported to the observer
+const (
+	OpSet     = "set"
+	OpMerge   = "merge"
+	OpProcess = "process"
+	OpAdd     = "add"
+)
+
+// Observer - receives the duration of the Set, Add, Merge and Process calls
+type Observer func(op string, d time.Duration)
+
+type observer struct {
+	atomic.Pointer[Observer]
+}
+
+// Observe - sets the observer of the db operations, nil removes it
+func (fdb *FileDB) Observe(o Observer) {
+	if o == nil {
+		fdb.observer.Store(nil)
+		return
+	}
+	fdb.observer.Store(&o)
+}
+
+// track starts timing op, the returned function reports it to the observer
+func (fdb *FileDB) track(op string) func() {
+	o := fdb.observer.Load()
+	if o == nil {
+		return func() {}
+	}
+	start := time.Now()
+	return func() {
+		(*o)(op, time.Since(start))
+	}
+}
@@ -6,6 +6,8 @@ var (
 	NewLine    = "\n"
 	FpRatio    = 0.0001
 	MaxItems   = uint(250000)
+	// SortChunkSize is the memory used by the ExternalSort strategy
+	SortChunkSize = 64 * 1024 * 1024 // 64Mb
 )
 
 type Options struct {
@@ -16,6 +18,19 @@ type Options struct {
 	SkipEmpty      bool
 	FilterCallback func(k, v []byte) bool
 	Dedupe         Strategy
+	// SortChunkSize overrides the memory used by the ExternalSort strategy
+	SortChunkSize int
+	// SortedOutput makes the ExternalSort strategy write the items sorted instead of in first seen order
+	SortedOutput bool
+	// Streaming dedupes and writes each added item right away instead of staging them until Process
+	Streaming bool
+	// OnItem receives the unique items written in streaming mode, k and v are only valid during the call
+	OnItem func(k, v []byte)
+	// Resume seeds the dedupe strategy with the items already in Path, so that they aren't appended again
+	Resume bool
+	// PersistFilter keeps the MemoryFilter bitset or the DiskFilter LevelDB next to Path, in Path.filter,
+	// so that resuming doesn't read the whole db as long as it wasn't modified in between
+	PersistFilter bool
 }
 
 type Stats struct {
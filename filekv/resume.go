@@ -0,0 +1,200 @@
+package filekv
+
+import (
+	"bufio"
+	"compress/zlib"
+	"encoding/json"
+	"io"
+	"os"
+	"path/filepath"
+
+	"github.com/bits-and-blooms/bloom/v3"
+	"github.com/syndtr/goleveldb/leveldb"
+)
+
+const (
+	filterMetaName  = "meta.json"
+	filterBloomName = "bloom"
+	filterDiskName  = "leveldb"
+)
+
+// filterMeta - describes the db a persisted filter was saved along with
+type filterMeta struct {
+	Size  int64 `json:"size"`
+	Items uint  `json:"items"`
+}
+
+// resume counts the items of the existing db, or trusts the persisted filter when the
+// db size didn't change since it was saved
+func (fdb *FileDB) resume() error {
+	if fdb.persistentFilter() {
+		if meta, err := fdb.readFilterMeta(); err == nil && meta.Size == fdb.outputSize() {
+			fdb.stats.NumberOfItems = meta.Items
+			fdb.filterFresh = true
+			return nil
+		}
+	}
+	return fdb.Scan(func(_, _ []byte) error {
+		fdb.stats.NumberOfItems++
+		return nil
+	})
+}
+
+// persistentFilter returns true if the filter is kept next to the db
+func (fdb *FileDB) persistentFilter() bool {
+	return fdb.options.PersistFilter && (fdb.options.Dedupe == MemoryFilter || fdb.options.Dedupe == DiskFilter)
+}
+
+func (fdb *FileDB) filterPath(name string) string {
+	return filepath.Join(fdb.options.Path+".filter", name)
+}
+
+func (fdb *FileDB) outputSize() int64 {
+	info, err := os.Stat(fdb.options.Path)
+	if err != nil {
+		return 0
+	}
+	return info.Size()
+}
+
+func (fdb *FileDB) readFilterMeta() (filterMeta, error) {
+	var meta filterMeta
+	data, err := os.ReadFile(fdb.filterPath(filterMetaName))
+	if err != nil {
+		return meta, err
+	}
+	err = json.Unmarshal(data, &meta)
+	return meta, err
+}
+
+// openPersistentFilter loads the persisted filter if fresh, or creates an empty one
+func (fdb *FileDB) openPersistentFilter(maxItems uint) error {
+	// the filter gets out of sync with the db as soon as items are added
+	if err := os.Remove(fdb.filterPath(filterMetaName)); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(fdb.filterPath(filterMetaName)), 0o700); err != nil {
+		return err
+	}
+
+	switch fdb.options.Dedupe {
+	case MemoryFilter:
+		if fdb.filterFresh {
+			if bdb, err := readBloom(fdb.filterPath(filterBloomName)); err == nil {
+				fdb.bdb = bdb
+				fdb.filterLoaded = true
+				return nil
+			}
+		}
+		fdb.bdb = bloom.NewWithEstimates(maxItems, FpRatio)
+	case DiskFilter:
+		fdb.ddbName = fdb.filterPath(filterDiskName)
+		if !fdb.filterFresh {
+			if err := os.RemoveAll(fdb.ddbName); err != nil {
+				return err
+			}
+		}
+		var err error
+		fdb.ddb, err = leveldb.OpenFile(fdb.ddbName, nil)
+		if err != nil {
+			return err
+		}
+		fdb.filterLoaded = fdb.filterFresh
+	}
+	return nil
+}
+
+// closePersistentFilter saves the filter along with the description of the db
+func (fdb *FileDB) closePersistentFilter() error {
+	switch fdb.options.Dedupe {
+	case MemoryFilter:
+		if err := writeFileAtomic(fdb.filterPath(filterBloomName), func(w io.Writer) error {
+			_, err := fdb.bdb.WriteTo(w)
+			return err
+		}); err != nil {
+			return err
+		}
+	case DiskFilter:
+		if err := fdb.ddb.Close(); err != nil {
+			return err
+		}
+	}
+	meta := filterMeta{Size: fdb.outputSize(), Items: fdb.stats.NumberOfItems}
+	fdb.filterFresh = true
+	return writeFileAtomic(fdb.filterPath(filterMetaName), func(w io.Writer) error {
+		return json.NewEncoder(w).Encode(meta)
+	})
+}
+
+func readBloom(path string) (*bloom.BloomFilter, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	var bdb bloom.BloomFilter
+	if _, err := bdb.ReadFrom(bufio.NewReader(f)); err != nil {
+		return nil, err
+	}
+	return &bdb, nil
+}
+
+// writeFileAtomic replaces path with the data written by write
+func writeFileAtomic(path string, write func(io.Writer) error) error {
+	f, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+".tmp*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(f.Name())
+	w := bufio.NewWriter(f)
+	if err := write(w); err != nil {
+		f.Close()
+		return err
+	}
+	if err := w.Flush(); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+	return os.Rename(f.Name(), path)
+}
+
+// multiStreamReader decompresses concatenated zlib streams, as written by successive runs
+// appending to a compressed db
+type multiStreamReader struct {
+	br *bufio.Reader
+	zr io.ReadCloser
+}
+
+func newMultiStreamReader(r io.Reader) (io.Reader, error) {
+	br := bufio.NewReader(r)
+	// empty db
+	if _, err := br.Peek(1); err == io.EOF {
+		return br, nil
+	}
+	zr, err := zlib.NewReader(br)
+	if err != nil {
+		return nil, err
+	}
+	return &multiStreamReader{br: br, zr: zr}, nil
+}
+
+func (m *multiStreamReader) Read(p []byte) (int, error) {
+	for {
+		n, err := m.zr.Read(p)
+		if err != io.EOF {
+			return n, err
+		}
+		if n > 0 {
+			return n, nil
+		}
+		if _, err := m.br.Peek(1); err != nil {
+			return 0, err
+		}
+		if err := m.zr.(zlib.Resetter).Reset(m.br, nil); err != nil {
+			return 0, err
+		}
+	}
+}
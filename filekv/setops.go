@@ -0,0 +1,249 @@
+package filekv
+
+import (
+	"fmt"
+	"io"
+	"os"
+
+	fileutil "github.com/projectdiscovery/utils/file"
+	permissionutil "github.com/projectdiscovery/utils/permission"
+)
+
+// The set operations accept as sources file names, io.Reader, []string and [][]byte holding
+// one item per line, and FileDB whose keys are used. They write the resulting items to a
+// db opened with options, which is returned processed and must be closed by the caller.
+//
+// Membership and the output are tracked with the options.Dedupe strategy, so results are
+// exact with MemoryMap, DiskFilter and ExternalSort and approximate with MemoryFilter, whose
+// false positives drop items. MemoryLRU forgets the evicted items, so it is replaced with
+// DiskFilter, and None, which would keep duplicates, is rejected with ErrSetStrategy.
+// ExternalSort tracks membership with DiskFilter.
+
+// Union - writes the items found in any of the sources
+func Union(options Options, sources ...interface{}) (*FileDB, error) {
+	options, err := setOptions(options)
+	if err != nil {
+		return nil, err
+	}
+	return compute(options, func(out *FileDB) error {
+		for _, source := range sources {
+			if err := forEachKey(source, out.emit); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// Intersection - writes the items of a found in all the other sources
+func Intersection(options Options, a interface{}, others ...interface{}) (*FileDB, error) {
+	options, err := setOptions(options)
+	if err != nil {
+		return nil, err
+	}
+	memberships := make([]*FileDB, 0, len(others))
+	defer func() {
+		for _, m := range memberships {
+			_ = m.closeFilter()
+		}
+	}()
+	for _, other := range others {
+		m, err := newMembership(options, other)
+		if err != nil {
+			return nil, err
+		}
+		memberships = append(memberships, m)
+	}
+	return compute(options, func(out *FileDB) error {
+		return forEachKey(a, func(k []byte) error {
+			for _, m := range memberships {
+				if !m.has(k) {
+					return nil
+				}
+			}
+			return out.emit(k)
+		})
+	})
+}
+
+// Difference - writes the items of a not found in any of the other sources
+func Difference(options Options, a interface{}, others ...interface{}) (*FileDB, error) {
+	options, err := setOptions(options)
+	if err != nil {
+		return nil, err
+	}
+	m, err := newMembership(options, others...)
+	if err != nil {
+		return nil, err
+	}
+	defer m.closeFilter()
+	return compute(options, func(out *FileDB) error {
+		return forEachKey(a, func(k []byte) error {
+			if m.has(k) {
+				return nil
+			}
+			return out.emit(k)
+		})
+	})
+}
+
+// SymmetricDifference - writes the items found in only one of a and b. Readers are read
+// twice, so they are first copied to temporary files
+func SymmetricDifference(options Options, a, b interface{}) (*FileDB, error) {
+	options, err := setOptions(options)
+	if err != nil {
+		return nil, err
+	}
+	sources := []interface{}{a, b}
+	for i, source := range sources {
+		if r, ok := source.(io.Reader); ok {
+			name, err := spool(r)
+			if err != nil {
+				return nil, err
+			}
+			defer os.Remove(name)
+			sources[i] = name
+		}
+	}
+	ma, err := newMembership(options, sources[0])
+	if err != nil {
+		return nil, err
+	}
+	defer ma.closeFilter()
+	mb, err := newMembership(options, sources[1])
+	if err != nil {
+		return nil, err
+	}
+	defer mb.closeFilter()
+	return compute(options, func(out *FileDB) error {
+		for _, side := range []struct {
+			source interface{}
+			other  *FileDB
+		}{{sources[0], mb}, {sources[1], ma}} {
+			if err := forEachKey(side.source, func(k []byte) error {
+				if side.other.has(k) {
+					return nil
+				}
+				return out.emit(k)
+			}); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// setOptions returns the options of a set operation, whose dedupe strategy must never keep
+// duplicates nor forget items
+func setOptions(options Options) (Options, error) {
+	switch options.Dedupe {
+	case None:
+		return options, ErrSetStrategy
+	case MemoryLRU:
+		options.Dedupe = DiskFilter
+	}
+	return options, nil
+}
+
+// compute opens the output db, fills it with fill and processes it
+func compute(options Options, fill func(out *FileDB) error) (*FileDB, error) {
+	out, err := Open(options)
+	if err != nil {
+		return nil, err
+	}
+	if err := fill(out); err != nil {
+		out.Close()
+		return nil, err
+	}
+	if err := out.Process(); err != nil {
+		out.Close()
+		return nil, err
+	}
+	return out, nil
+}
+
+// emit adds an item to the output db, staging it or writing it in streaming mode
+func (fdb *FileDB) emit(k []byte) error {
+	_, err := fdb.mergeLines(1, func(int) []byte { return k })
+	return err
+}
+
+// newMembership returns a filter-only db holding the keys of the sources
+func newMembership(options Options, sources ...interface{}) (*FileDB, error) {
+	strategy := options.Dedupe
+	if strategy == ExternalSort {
+		strategy = DiskFilter
+	}
+	maxItems := MaxItems
+	if options.MaxItems > 0 {
+		maxItems = options.MaxItems
+	}
+	m := &FileDB{options: Options{Dedupe: strategy}}
+	if err := m.createFilter(maxItems); err != nil {
+		return nil, err
+	}
+	for _, source := range sources {
+		if err := forEachKey(source, func(k []byte) error {
+			m.seen(k)
+			return nil
+		}); err != nil {
+			_ = m.closeFilter()
+			return nil, err
+		}
+	}
+	return m, nil
+}
+
+// forEachKey calls f on the items of a source, k is only valid during the call
+func forEachKey(source interface{}, f func(k []byte) error) error {
+	switch s := source.(type) {
+	case *FileDB:
+		return s.Scan(func(k, _ []byte) error {
+			return f(k)
+		})
+	case string:
+		file, err := os.Open(s)
+		if err != nil {
+			return err
+		}
+		defer file.Close()
+		return forEachKey(file, f)
+	case io.Reader:
+		return scanLines(s, func(_ uint64, line []byte) error {
+			return f(line)
+		})
+	case []string:
+		for _, item := range s {
+			if err := f([]byte(item)); err != nil {
+				return err
+			}
+		}
+	case [][]byte:
+		for _, item := range s {
+			if err := f(item); err != nil {
+				return err
+			}
+		}
+	default:
+		return fmt.Errorf("%w: %T", ErrUnsupportedSource, source)
+	}
+	return nil
+}
+
+// spool copies r to a temporary file
+func spool(r io.Reader) (string, error) {
+	name, err := fileutil.GetTempFileName()
+	if err != nil {
+		return "", err
+	}
+	f, err := os.OpenFile(name, os.O_RDWR|os.O_CREATE|os.O_TRUNC, permissionutil.TempFilePermission)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+	if _, err := io.Copy(f, r); err != nil {
+		os.Remove(name)
+		return "", err
+	}
+	return name, f.Close()
+}
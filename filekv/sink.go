@@ -0,0 +1,116 @@
+package filekv
+
+import (
+	"bytes"
+	"sync"
+)
+
+// sinkBatchSize is the max number of queued items written at once
+const sinkBatchSize = 1024
+
+// Sink - streams items from many goroutines into the temporary file of a db, or through Add
+// in streaming mode, via a single writer as Merge does. Items are queued in a channel so that producers don't
+// contend on the db lock
+type Sink struct {
+	fdb   *FileDB
+	items chan []byte
+	done  chan struct{}
+
+	mu     sync.RWMutex
+	closed bool
+
+	count uint
+	err   error
+}
+
+// NewSink - starts a sink queuing up to buffer items, Close must be called before Process
+func (fdb *FileDB) NewSink(buffer int) *Sink {
+	s := &Sink{
+		fdb:   fdb,
+		items: make(chan []byte, buffer),
+		done:  make(chan struct{}),
+	}
+	go s.run()
+	return s
+}
+
+func (s *Sink) run() {
+	defer close(s.done)
+	var batch bytes.Buffer
+	for item := range s.items {
+		if s.fdb.options.Streaming {
+			if s.err == nil {
+				if s.err = s.fdb.addLine(item); s.err == nil {
+					s.count++
+				}
+			}
+			continue
+		}
+		var count uint
+		batch.Reset()
+		// drain the queued items
+		for {
+			batch.Write(item)
+			batch.WriteString(NewLine)
+			count++
+			if count == sinkBatchSize {
+				break
+			}
+			var ok bool
+			select {
+			case item, ok = <-s.items:
+			default:
+			}
+			if !ok {
+				break
+			}
+		}
+		if s.err != nil {
+			continue
+		}
+		if err := s.fdb.writeLines(batch.Bytes(), count); err != nil {
+			s.err = err
+			continue
+		}
+		s.count += count
+	}
+}
+
+// Add - queues a copy of item, it's safe for concurrent use and fails with ErrSinkClosed
+// once the sink is closed
+func (s *Sink) Add(item []byte) error {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	if s.closed {
+		return ErrSinkClosed
+	}
+	s.items <- bytes.Clone(item)
+	return nil
+}
+
+// Write - queues the newline separated items of p, so that the sink can be used as an
+// io.Writer. Each call must hold whole lines
+func (s *Sink) Write(p []byte) (int, error) {
+	if len(p) == 0 {
+		return 0, nil
+	}
+	for _, item := range bytes.Split(bytes.TrimSuffix(p, []byte(NewLine)), []byte(NewLine)) {
+		if err := s.Add(item); err != nil {
+			return 0, err
+		}
+	}
+	return len(p), nil
+}
+
+// Close - waits for the queued items to be written and returns how many were written
+// along with the first write error
+func (s *Sink) Close() (uint, error) {
+	s.mu.Lock()
+	if !s.closed {
+		s.closed = true
+		close(s.items)
+	}
+	s.mu.Unlock()
+	<-s.done
+	return s.count, s.err
+}
@@ -0,0 +1,330 @@
+package filekv
+
+import (
+	"bufio"
+	"bytes"
+	"compress/zlib"
+	"container/heap"
+	"encoding/binary"
+	"io"
+	"iter"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+
+	fileutil "github.com/projectdiscovery/utils/file"
+)
+
+// record - represents a line of the temporary file along with its position
+type record struct {
+	key []byte
+	seq uint64
+}
+
+// recordOverhead approximates the memory used by a record besides its key
+const recordOverhead = 48
+
+func byKey(a, b record) int {
+	if c := bytes.Compare(a.key, b.key); c != 0 {
+		return c
+	}
+	return compareSeq(a, b)
+}
+
+func compareSeq(a, b record) int {
+	switch {
+	case a.seq < b.seq:
+		return -1
+	case a.seq > b.seq:
+		return 1
+	default:
+		return 0
+	}
+}
+
+// sorter sorts records with bounded memory: records are buffered up to limit bytes, then
+// sorted and written to a run file, and the runs are finally merged
+type sorter struct {
+	dir     string
+	limit   int
+	compare func(a, b record) int
+	chunk   []record
+	size    int
+	runs    []string
+}
+
+func (s *sorter) add(key []byte, seq uint64) error {
+	s.chunk = append(s.chunk, record{key: bytes.Clone(key), seq: seq})
+	s.size += len(key) + recordOverhead
+	if s.size >= s.limit {
+		return s.flush()
+	}
+	return nil
+}
+
+// flush writes the buffered records to a new sorted run
+func (s *sorter) flush() error {
+	if len(s.chunk) == 0 {
+		return nil
+	}
+	slices.SortFunc(s.chunk, s.compare)
+	name := filepath.Join(s.dir, strconv.Itoa(len(s.runs)))
+	f, err := os.Create(name)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	w := bufio.NewWriter(f)
+	buf := make([]byte, 0, 2*binary.MaxVarintLen64)
+	for _, r := range s.chunk {
+		buf = binary.AppendUvarint(buf[:0], r.seq)
+		buf = binary.AppendUvarint(buf, uint64(len(r.key)))
+		if _, err := w.Write(buf); err != nil {
+			return err
+		}
+		if _, err := w.Write(r.key); err != nil {
+			return err
+		}
+	}
+	if err := w.Flush(); err != nil {
+		return err
+	}
+	s.runs = append(s.runs, name)
+	s.chunk = s.chunk[:0]
+	s.size = 0
+	return f.Close()
+}
+
+// merge calls f on all the records in order, the record key is only valid during the call
+func (s *sorter) merge(f func(record) error) error {
+	// everything fit in memory
+	if len(s.runs) == 0 {
+		slices.SortFunc(s.chunk, s.compare)
+		for _, r := range s.chunk {
+			if err := f(r); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	if err := s.flush(); err != nil {
+		return err
+	}
+	s.chunk = nil
+
+	h := &runHeap{compare: s.compare}
+	for _, name := range s.runs {
+		file, err := os.Open(name)
+		if err != nil {
+			return err
+		}
+		defer file.Close()
+		run := &run{r: bufio.NewReader(file)}
+		ok, err := run.next()
+		if err != nil {
+			return err
+		}
+		if ok {
+			h.runs = append(h.runs, run)
+		}
+	}
+	heap.Init(h)
+	for h.Len() > 0 {
+		run := h.runs[0]
+		if err := f(run.current); err != nil {
+			return err
+		}
+		ok, err := run.next()
+		if err != nil {
+			return err
+		}
+		if ok {
+			heap.Fix(h, 0)
+		} else {
+			heap.Pop(h)
+		}
+	}
+	return nil
+}
+
+// run reads the records of a run file
+type run struct {
+	r       *bufio.Reader
+	current record
+}
+
+func (r *run) next() (bool, error) {
+	seq, err := binary.ReadUvarint(r.r)
+	if err == io.EOF {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	n, err := binary.ReadUvarint(r.r)
+	if err != nil {
+		return false, err
+	}
+	r.current.seq = seq
+	r.current.key = slices.Grow(r.current.key[:0], int(n))[:n]
+	_, err = io.ReadFull(r.r, r.current.key)
+	return err == nil, err
+}
+
+// runHeap orders the runs by their current record
+type runHeap struct {
+	runs    []*run
+	compare func(a, b record) int
+}
+
+func (h *runHeap) Len() int           { return len(h.runs) }
+func (h *runHeap) Less(i, j int) bool { return h.compare(h.runs[i].current, h.runs[j].current) < 0 }
+func (h *runHeap) Swap(i, j int)      { h.runs[i], h.runs[j] = h.runs[j], h.runs[i] }
+func (h *runHeap) Push(x any)         { h.runs = append(h.runs, x.(*run)) }
+func (h *runHeap) Pop() any {
+	old := h.runs
+	x := old[len(old)-1]
+	h.runs = old[:len(old)-1]
+	return x
+}
+
+// externalSort deduplicates the lines read from r exactly with bounded memory and writes
+// them to the db, either sorted or in first seen order
+func (fdb *FileDB) externalSort(r io.Reader) error {
+	dir, err := os.MkdirTemp("", fileutil.ExecutableName())
+	if err != nil {
+		return err
+	}
+	defer os.RemoveAll(dir)
+
+	limit := fdb.options.SortChunkSize
+	if limit <= 0 {
+		limit = SortChunkSize
+	}
+	lines := &sorter{dir: filepath.Join(dir, "lines"), limit: limit, compare: byKey}
+	if err := os.Mkdir(lines.dir, 0o700); err != nil {
+		return err
+	}
+	// the items of a resumed db come first, so that they are the first occurrences
+	var existing uint64
+	if fdb.options.Resume {
+		if err := fdb.Scan(func(k, _ []byte) error {
+			existing++
+			return lines.add(k, existing-1)
+		}); err != nil {
+			return err
+		}
+	}
+	if err := scanLines(r, func(seq uint64, line []byte) error {
+		return lines.add(line, existing+seq)
+	}); err != nil {
+		return err
+	}
+
+	var (
+		previous []byte
+		started  bool
+	)
+	unique := func(r record, f func(record) error) error {
+		if started && bytes.Equal(previous, r.key) {
+			fdb.stats.NumberOfDupedItems++
+			return nil
+		}
+		previous, started = append(previous[:0], r.key...), true
+		return f(r)
+	}
+
+	if fdb.options.SortedOutput {
+		return lines.merge(func(r record) error {
+			return unique(r, func(r record) error {
+				if r.seq < existing {
+					return nil
+				}
+				return fdb.setUnique(r.key)
+			})
+		})
+	}
+
+	// collect the positions of the first occurrences, then sort them to pick the lines
+	// during a second pass over the temporary file
+	firsts := &sorter{dir: filepath.Join(dir, "firsts"), limit: limit, compare: compareSeq}
+	if err := os.Mkdir(firsts.dir, 0o700); err != nil {
+		return err
+	}
+	if err := lines.merge(func(r record) error {
+		return unique(r, func(r record) error {
+			if r.seq < existing {
+				return nil
+			}
+			return firsts.add(nil, r.seq-existing)
+		})
+	}); err != nil {
+		return err
+	}
+
+	tmpDb, err := os.Open(fdb.tmpDbName)
+	if err != nil {
+		return err
+	}
+	defer tmpDb.Close()
+	var tmpDbReader io.Reader = tmpDb
+	if fdb.options.Compress {
+		if tmpDbReader, err = zlib.NewReader(tmpDb); err != nil {
+			return err
+		}
+	}
+	var mergeErr error
+	next, stop := iter.Pull(firsts.seqs(&mergeErr))
+	defer stop()
+	want, ok := next()
+	if err := scanLines(tmpDbReader, func(seq uint64, line []byte) error {
+		if !ok || seq != want {
+			return nil
+		}
+		want, ok = next()
+		return fdb.setUnique(line)
+	}); err != nil {
+		return err
+	}
+	return mergeErr
+}
+
+// setUnique writes a deduplicated line to the db unless it's filtered
+func (fdb *FileDB) setUnique(k []byte) error {
+	if fdb.shouldSkip(k, nil) {
+		fdb.stats.NumberOfFilteredItems++
+		return nil
+	}
+	return fdb.set(k, nil)
+}
+
+// scanLines calls f on each line of r along with its position
+func scanLines(r io.Reader, f func(seq uint64, line []byte) error) error {
+	sc := bufio.NewScanner(r)
+	buf := make([]byte, BufferSize)
+	sc.Buffer(buf, BufferSize)
+	var seq uint64
+	for sc.Scan() {
+		if err := f(seq, sc.Bytes()); err != nil {
+			return err
+		}
+		seq++
+	}
+	return sc.Err()
+}
+
+// seqs returns an iterator over the sorted positions of s, err is set once the iteration ends
+func (s *sorter) seqs(err *error) iter.Seq[uint64] {
+	return func(yield func(uint64) bool) {
+		*err = s.merge(func(r record) error {
+			if !yield(r.seq) {
+				return errStopIteration
+			}
+			return nil
+		})
+		if *err == errStopIteration {
+			*err = nil
+		}
+	}
+}
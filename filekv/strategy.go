@@ -12,4 +12,7 @@ const (
 	MemoryFilter
 	// Use full disk kv store to remove all duplicates - it should have low heap memory footprint but lots of I/O interactions
 	DiskFilter
+	// ExternalSort removes all duplicates by sorting the items in chunks of bounded size on disk and merging them,
+	// the output keeps the first seen order unless Options.SortedOutput is set
+	ExternalSort
 )
@@ -0,0 +1,40 @@
+package filekv
+
+import "errors"
+
+// Add - in streaming mode dedupes an item against the strategy and writes it right away,
+// then passes it to OnItem. It fails with ErrItemExists or ErrItemFiltered for skipped items
+func (fdb *FileDB) Add(k, v []byte) error {
+	if !fdb.options.Streaming {
+		return ErrNotStreaming
+	}
+	defer fdb.track(OpAdd)()
+
+	fdb.Lock()
+	fdb.stats.NumberOfAddedItems++
+	err := fdb.dedupeAndSet(k, v)
+	fdb.Unlock()
+	if err == nil && fdb.options.OnItem != nil {
+		fdb.options.OnItem(k, v)
+	}
+	return err
+}
+
+// addLine adds an item merged in streaming mode, where skipped items aren't errors
+func (fdb *FileDB) addLine(line []byte) error {
+	err := fdb.Add(line, nil)
+	if errors.Is(err, ErrItemExists) || errors.Is(err, ErrItemFiltered) {
+		return nil
+	}
+	return err
+}
+
+// endStream flushes the output of a streaming db and releases the dedupe filter
+func (fdb *FileDB) endStream() error {
+	err := fdb.dbWriter.Close()
+	_ = fdb.db.Close()
+	if ferr := fdb.closeFilter(); err == nil {
+		err = ferr
+	}
+	return err
+}
@@ -0,0 +1,149 @@
+package metrics
+
+import (
+	"bufio"
+	"expvar"
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// collected - represents a sample of a store
+type collected struct {
+	store string
+	sample
+}
+
+// gather collects the samples of every store grouped by family and the latency histograms
+// by store and operation
+func (r *Registry) gather() (map[string][]collected, map[string]map[string]HistogramSnapshot) {
+	samples := make(map[string][]collected)
+	latencies := make(map[string]map[string]HistogramSnapshot)
+	interval := r.interval()
+	for _, s := range r.sorted() {
+		for _, smp := range append(s.collect(), s.items(interval)...) {
+			samples[smp.family] = append(samples[smp.family], collected{store: s.name, sample: smp})
+		}
+		latencies[s.name] = s.snapshots()
+	}
+	return samples, latencies
+}
+
+var labelEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+
+func formatLabels(labels ...string) string {
+	var b strings.Builder
+	b.WriteByte('{')
+	for i := 0; i+1 < len(labels); i += 2 {
+		if i > 0 {
+			b.WriteByte(',')
+		}
+		fmt.Fprintf(&b, `%s="%s"`, labels[i], labelEscaper.Replace(labels[i+1]))
+	}
+	b.WriteByte('}')
+	return b.String()
+}
+
+func formatFloat(v float64) string {
+	return strconv.FormatFloat(v, 'g', -1, 64)
+}
+
+// WriteText - writes the metrics of the registered stores in the Prometheus text exposition format
+func (r *Registry) WriteText(w io.Writer) error {
+	samples, latencies := r.gather()
+	names := make([]string, 0, len(families))
+	for name := range families {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	bw := bufio.NewWriter(w)
+	for _, name := range names {
+		f := families[name]
+		if name == latencyFamily {
+			writeLatencies(bw, f, latencies)
+			continue
+		}
+		if len(samples[name]) == 0 {
+			continue
+		}
+		fmt.Fprintf(bw, "# HELP %s %s\n# TYPE %s %s\n", name, f.help, name, f.kind)
+		for _, smp := range samples[name] {
+			labels := []string{"store", smp.store}
+			if smp.label != "" {
+				labels = append(labels, smp.label, smp.value)
+			}
+			fmt.Fprintf(bw, "%s%s %s\n", name, formatLabels(labels...), formatFloat(smp.v))
+		}
+	}
+	return bw.Flush()
+}
+
+func writeLatencies(w io.Writer, f family, latencies map[string]map[string]HistogramSnapshot) {
+	stores := make([]string, 0, len(latencies))
+	for store, ops := range latencies {
+		if len(ops) > 0 {
+			stores = append(stores, store)
+		}
+	}
+	if len(stores) == 0 {
+		return
+	}
+	sort.Strings(stores)
+	fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s %s\n", latencyFamily, f.help, latencyFamily, f.kind)
+	for _, store := range stores {
+		ops := make([]string, 0, len(latencies[store]))
+		for op := range latencies[store] {
+			ops = append(ops, op)
+		}
+		sort.Strings(ops)
+		for _, op := range ops {
+			h := latencies[store][op]
+			for i, bound := range h.Buckets {
+				fmt.Fprintf(w, "%s_bucket%s %d\n", latencyFamily, formatLabels("store", store, "op", op, "le", formatFloat(bound)), h.Counts[i])
+			}
+			fmt.Fprintf(w, "%s_bucket%s %d\n", latencyFamily, formatLabels("store", store, "op", op, "le", "+Inf"), h.Count)
+			fmt.Fprintf(w, "%s_sum%s %s\n", latencyFamily, formatLabels("store", store, "op", op), formatFloat(h.Sum))
+			fmt.Fprintf(w, "%s_count%s %d\n", latencyFamily, formatLabels("store", store, "op", op), h.Count)
+		}
+	}
+}
+
+// Handler - serves the metrics in the Prometheus text exposition format
+func (r *Registry) Handler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+		_ = r.WriteText(w)
+	})
+}
+
+// Snapshot - returns the metrics by store, keyed by metric name suffixed with the extra
+// label value, with the latencies under "latency" by operation
+func (r *Registry) Snapshot() map[string]map[string]interface{} {
+	samples, latencies := r.gather()
+	snapshot := make(map[string]map[string]interface{})
+	for store, ops := range latencies {
+		snapshot[store] = map[string]interface{}{"latency": ops}
+	}
+	for name, values := range samples {
+		for _, smp := range values {
+			key := name
+			if smp.value != "" {
+				key += "_" + smp.value
+			}
+			snapshot[smp.store][key] = smp.v
+		}
+	}
+	return snapshot
+}
+
+// PublishExpvar - publishes the snapshot of the metrics as the expvar variable name,
+// it panics if the name is already in use
+func (r *Registry) PublishExpvar(name string) {
+	expvar.Publish(name, expvar.Func(func() interface{} {
+		return r.Snapshot()
+	}))
+}
@@ -0,0 +1,68 @@
+package metrics
+
+import (
+	"sync/atomic"
+	"time"
+)
+
+// DefaultBuckets - the upper bounds in seconds of the latency histograms, from 10µs to 10s
+var DefaultBuckets = []float64{0.00001, 0.00005, 0.0001, 0.0005, 0.001, 0.005, 0.01, 0.05, 0.1, 0.5, 1, 5, 10}
+
+// Histogram - counts durations in cumulative buckets
+type Histogram struct {
+	buckets []float64
+	counts  []atomic.Uint64
+	count   atomic.Uint64
+	sum     atomic.Int64 // nanoseconds
+}
+
+// NewHistogram creates a histogram with the given bucket upper bounds in seconds, sorted
+// in increasing order
+func NewHistogram(buckets []float64) *Histogram {
+	return &Histogram{
+		buckets: buckets,
+		counts:  make([]atomic.Uint64, len(buckets)),
+	}
+}
+
+// Observe - records a duration
+func (h *Histogram) Observe(d time.Duration) {
+	seconds := d.Seconds()
+	for i, bound := range h.buckets {
+		if seconds <= bound {
+			h.counts[i].Add(1)
+			break
+		}
+	}
+	h.count.Add(1)
+	h.sum.Add(int64(d))
+}
+
+// HistogramSnapshot - represents the state of a histogram at a point in time
+type HistogramSnapshot struct {
+	// Buckets are the upper bounds in seconds
+	Buckets []float64
+	// Counts are the cumulative counts of the observations within each bucket
+	Counts []uint64
+	Count  uint64
+	// Sum is the total of the observations in seconds
+	Sum float64
+}
+
+// Snapshot - returns the current state of the histogram. The buckets are loaded before the
+// count, and the count is never lower than the last cumulative bucket, so that an observation
+// racing with the snapshot can't make a bucket exceed the +Inf one
+func (h *Histogram) Snapshot() HistogramSnapshot {
+	snapshot := HistogramSnapshot{
+		Buckets: h.buckets,
+		Counts:  make([]uint64, len(h.buckets)),
+	}
+	var cumulative uint64
+	for i := range h.counts {
+		cumulative += h.counts[i].Load()
+		snapshot.Counts[i] = cumulative
+	}
+	snapshot.Count = max(h.count.Load(), cumulative)
+	snapshot.Sum = time.Duration(h.sum.Load()).Seconds()
+	return snapshot
+}
@@ -0,0 +1,153 @@
+package metrics
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/projectdiscovery/hmap/filekv"
+	"github.com/projectdiscovery/hmap/store/disk"
+	"github.com/projectdiscovery/hmap/store/hybrid"
+	"github.com/stretchr/testify/require"
+)
+
+func TestHistogram(t *testing.T) {
+	h := NewHistogram([]float64{0.001, 0.01})
+	h.Observe(500 * time.Microsecond)
+	h.Observe(5 * time.Millisecond)
+	h.Observe(time.Second)
+
+	snapshot := h.Snapshot()
+	require.Equal(t, []uint64{1, 2}, snapshot.Counts)
+	require.Equal(t, uint64(3), snapshot.Count)
+	require.InDelta(t, 1.0055, snapshot.Sum, 1e-9)
+}
+
+func TestHistogramSnapshotInvariant(t *testing.T) {
+	h := NewHistogram([]float64{0.001})
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for i := 0; i < 100000; i++ {
+			h.Observe(time.Microsecond)
+		}
+	}()
+	for {
+		select {
+		case <-done:
+			return
+		default:
+		}
+		snapshot := h.Snapshot()
+		require.GreaterOrEqual(t, snapshot.Count, snapshot.Counts[0])
+	}
+}
+
+func TestRegistry(t *testing.T) {
+	registry := NewRegistry()
+
+	hm, err := hybrid.New(hybrid.DefaultHybridOptions)
+	require.Nil(t, err)
+	defer hm.Close()
+	require.Nil(t, registry.RegisterMap("hosts", hm))
+	require.ErrorIs(t, registry.RegisterMap("hosts", hm), ErrDuplicateStore)
+	require.Nil(t, hm.Set("a", []byte("1")))
+	_, _ = hm.Get("a")
+	_, _ = hm.Get("missing")
+
+	ldb, err := disk.OpenLevelDB(t.TempDir())
+	require.Nil(t, err)
+	defer ldb.Close()
+	db, err := registry.RegisterDB("ports", ldb)
+	require.Nil(t, err)
+	require.Nil(t, db.Set("80", []byte("http"), 0))
+	require.Nil(t, db.GC())
+
+	opts := filekv.DefaultOptions
+	opts.Path = filepath.Join(t.TempDir(), "db")
+	fdb, err := filekv.Open(opts)
+	require.Nil(t, err)
+	defer fdb.Close()
+	require.Nil(t, registry.RegisterFileDB("targets", fdb))
+	_, err = fdb.Merge([]string{"a", "b", "a"})
+	require.Nil(t, err)
+	require.Nil(t, fdb.Process())
+
+	var buf bytes.Buffer
+	require.Nil(t, registry.WriteText(&buf))
+	text := buf.String()
+	for _, line := range []string{
+		"# TYPE hmap_hits_total counter",
+		`hmap_hits_total{store="hosts",tier="memory"} 1`,
+		`hmap_misses_total{store="hosts",tier="disk"} 1`,
+		`hmap_hit_ratio{store="hosts",tier="memory"} 0.5`,
+		`hmap_hits_total{store="ports",tier="disk"} 0`,
+		`hmap_items{store="targets"} 2`,
+		`hmap_filekv_duped_total{store="targets"} 1`,
+		`hmap_memory_guard_force_disk{store="hosts"} 0`,
+		"# TYPE hmap_operation_duration_seconds histogram",
+		`hmap_operation_duration_seconds_count{store="hosts",op="get"} 2`,
+		`hmap_operation_duration_seconds_bucket{store="ports",op="gc",le="+Inf"} 1`,
+		`hmap_operation_duration_seconds_count{store="targets",op="process"} 1`,
+	} {
+		require.Contains(t, text, line+"\n")
+	}
+	require.Equal(t, 1, strings.Count(text, "# TYPE hmap_items gauge"))
+	// the items of maps and dbs are not counted by default
+	require.NotContains(t, text, `hmap_items{store="ports"}`)
+	require.NotContains(t, text, `hmap_items{store="hosts"}`)
+	// scrapes don't read the disk store
+	diskReads := hm.Stats().DiskReads
+	require.Nil(t, registry.WriteText(&bytes.Buffer{}))
+	require.Equal(t, diskReads, hm.Stats().DiskReads)
+
+	registry.CountItems(time.Hour)
+	rec := httptest.NewRecorder()
+	registry.Handler().ServeHTTP(rec, httptest.NewRequest("GET", "/metrics", nil))
+	require.Contains(t, rec.Header().Get("Content-Type"), "text/plain")
+	require.Contains(t, rec.Body.String(), `hmap_items{store="ports"} 1`)
+	require.Contains(t, rec.Body.String(), `hmap_items{store="hosts"} 1`)
+	// the counts are cached until the interval elapses
+	require.Nil(t, db.Set("443", []byte("https"), 0))
+	buf.Reset()
+	require.Nil(t, registry.WriteText(&buf))
+	require.Contains(t, buf.String(), `hmap_items{store="ports"} 1`+"\n")
+	registry.CountItems(time.Nanosecond)
+	buf.Reset()
+	require.Nil(t, registry.WriteText(&buf))
+	require.Contains(t, buf.String(), `hmap_items{store="ports"} 2`+"\n")
+
+	data, err := json.Marshal(registry.Snapshot())
+	require.Nil(t, err)
+	var snapshot map[string]map[string]interface{}
+	require.Nil(t, json.Unmarshal(data, &snapshot))
+	require.Equal(t, float64(1), snapshot["hosts"]["hmap_hits_total_memory"])
+	require.Contains(t, snapshot["ports"]["latency"], "gc")
+
+	registry.Unregister("hosts")
+	_, _ = hm.Get("a")
+	buf.Reset()
+	require.Nil(t, registry.WriteText(&buf))
+	require.NotContains(t, buf.String(), `store="hosts"`)
+}
+
+func TestSweepRegisteredDB(t *testing.T) {
+	ldb, err := disk.OpenLevelDB(t.TempDir())
+	require.Nil(t, err)
+	defer ldb.Close()
+	db, err := NewRegistry().RegisterDB("ports", ldb)
+	require.Nil(t, err)
+	require.Nil(t, db.Set("80", []byte("http"), time.Millisecond))
+	time.Sleep(5 * time.Millisecond)
+
+	sweeper, err := disk.NewSweeper(db, disk.SweeperOptions{Interval: time.Hour})
+	require.Nil(t, err)
+	defer sweeper.Stop()
+	reclaimed, err := sweeper.Sweep()
+	require.Nil(t, err)
+	require.Equal(t, 1, reclaimed)
+}
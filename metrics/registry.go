@@ -0,0 +1,269 @@
+// Package metrics exports the statistics and the operation latencies of hmap stores in the
+// Prometheus text exposition format or through expvar, without any dependency:
+//
+//	registry := metrics.NewRegistry()
+//	_ = registry.RegisterMap("hosts", hm)
+//	http.Handle("/metrics", registry.Handler())
+package metrics
+
+import (
+	"errors"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/projectdiscovery/hmap/filekv"
+	"github.com/projectdiscovery/hmap/store/disk"
+	"github.com/projectdiscovery/hmap/store/hybrid"
+)
+
+var ErrDuplicateStore = errors.New("store already registered")
+
+// DefaultRegistry - a registry ready to use
+var DefaultRegistry = NewRegistry()
+
+// Registry - collects the metrics of the registered stores
+type Registry struct {
+	mu      sync.RWMutex
+	stores  map[string]*store
+	buckets []float64
+	// countInterval is the minimum delay between two counts of the items, 0 disabling them
+	countInterval time.Duration
+}
+
+// NewRegistry creates an empty registry measuring latencies with DefaultBuckets
+func NewRegistry() *Registry {
+	return &Registry{
+		stores:  make(map[string]*store),
+		buckets: DefaultBuckets,
+	}
+}
+
+// store - represents a registered store
+type store struct {
+	name string
+	// collect returns the samples cheap enough to be collected on every scrape
+	collect func() []sample
+	// count returns the item samples, which require a full scan of the store
+	count func() []sample
+	// release detaches the observer from the store
+	release func()
+
+	mu        sync.Mutex
+	buckets   []float64
+	latencies map[string]*Histogram
+
+	// countMu serializes the counts without blocking the observations
+	countMu   sync.Mutex
+	counted   []sample
+	countedAt time.Time
+}
+
+// observe records the duration of an operation of the store
+func (s *store) observe(op string, d time.Duration) {
+	s.mu.Lock()
+	h, ok := s.latencies[op]
+	if !ok {
+		h = NewHistogram(s.buckets)
+		s.latencies[op] = h
+	}
+	s.mu.Unlock()
+	h.Observe(d)
+}
+
+// items returns the item samples, counted again once interval has elapsed since the last count
+func (s *store) items(interval time.Duration) []sample {
+	if interval <= 0 || s.count == nil {
+		return nil
+	}
+	s.countMu.Lock()
+	defer s.countMu.Unlock()
+	if s.counted == nil || time.Since(s.countedAt) >= interval {
+		s.counted = s.count()
+		s.countedAt = time.Now()
+	}
+	return s.counted
+}
+
+// snapshots returns the latency histograms by operation
+func (s *store) snapshots() map[string]HistogramSnapshot {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	snapshots := make(map[string]HistogramSnapshot, len(s.latencies))
+	for op, h := range s.latencies {
+		snapshots[op] = h.Snapshot()
+	}
+	return snapshots
+}
+
+// CountItems - exports the number of items, their size and the expired ones of the maps and
+// dbs, counting them again at most once every interval. Counting them requires a full scan of
+// the disk stores, hence they are not exported by default; an interval of 0 disables them
+func (r *Registry) CountItems(interval time.Duration) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.countInterval = interval
+}
+
+// interval returns the minimum delay between two counts of the items
+func (r *Registry) interval() time.Duration {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return r.countInterval
+}
+
+func (r *Registry) add(name string, collect, count func() []sample) (*store, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if _, ok := r.stores[name]; ok {
+		return nil, ErrDuplicateStore
+	}
+	s := &store{
+		name:      name,
+		collect:   collect,
+		count:     count,
+		release:   func() {},
+		buckets:   r.buckets,
+		latencies: make(map[string]*Histogram),
+	}
+	r.stores[name] = s
+	return s, nil
+}
+
+// RegisterMap - collects the counters of hm and the latencies of its operations, replacing
+// any observer set on hm. Its items are counted only when enabled with CountItems
+func (r *Registry) RegisterMap(name string, hm *hybrid.HybridMap) error {
+	s, err := r.add(name, func() []sample {
+		return mapSamples(hm)
+	}, func() []sample {
+		return mapItemSamples(hm)
+	})
+	if err != nil {
+		return err
+	}
+	hm.Observe(s.observe)
+	s.release = func() { hm.Observe(nil) }
+	return nil
+}
+
+// RegisterDB - collects the counters of db. The latencies, GC included, are measured on the
+// calls made through the returned db, which can be swept with disk.NewSweeper. Its records
+// are counted only when enabled with CountItems
+func (r *Registry) RegisterDB(name string, db disk.DB) (disk.DB, error) {
+	s, err := r.add(name, func() []sample {
+		return dbSamples(db.Counters())
+	}, func() []sample {
+		return dbItemSamples(db.Stats())
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &instrumentedDB{DB: db, observe: s.observe}, nil
+}
+
+// RegisterFileDB - collects the stats of fdb and the latencies of its operations, replacing
+// any observer set on fdb
+func (r *Registry) RegisterFileDB(name string, fdb *filekv.FileDB) error {
+	s, err := r.add(name, func() []sample {
+		return fileDBSamples(fdb)
+	}, nil)
+	if err != nil {
+		return err
+	}
+	fdb.Observe(s.observe)
+	s.release = func() { fdb.Observe(nil) }
+	return nil
+}
+
+// Unregister - stops collecting the metrics of the named store
+func (r *Registry) Unregister(name string) {
+	r.mu.Lock()
+	s, ok := r.stores[name]
+	delete(r.stores, name)
+	r.mu.Unlock()
+	if ok {
+		s.release()
+	}
+}
+
+// sorted returns the registered stores by name
+func (r *Registry) sorted() []*store {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	stores := make([]*store, 0, len(r.stores))
+	for _, s := range r.stores {
+		stores = append(stores, s)
+	}
+	sort.Slice(stores, func(i, j int) bool {
+		return stores[i].name < stores[j].name
+	})
+	return stores
+}
+
+// instrumentedDB measures the latencies of the calls to a disk.DB
+type instrumentedDB struct {
+	disk.DB
+	observe func(op string, d time.Duration)
+}
+
+// Unwrap - returns the measured db, letting disk.NewSweeper reach the backend
+func (db *instrumentedDB) Unwrap() disk.DB {
+	return db.DB
+}
+
+func (db *instrumentedDB) track(op string) func() {
+	start := time.Now()
+	return func() {
+		db.observe(op, time.Since(start))
+	}
+}
+
+func (db *instrumentedDB) Get(k string) ([]byte, error) {
+	defer db.track("get")()
+	return db.DB.Get(k)
+}
+
+func (db *instrumentedDB) GetWithExpiration(k string) ([]byte, time.Time, error) {
+	defer db.track("get")()
+	return db.DB.GetWithExpiration(k)
+}
+
+func (db *instrumentedDB) MGet(keys []string) [][]byte {
+	defer db.track("mget")()
+	return db.DB.MGet(keys)
+}
+
+func (db *instrumentedDB) Set(k string, v []byte, ttl time.Duration) error {
+	defer db.track("set")()
+	return db.DB.Set(k, v, ttl)
+}
+
+func (db *instrumentedDB) MSet(data map[string][]byte) error {
+	defer db.track("mset")()
+	return db.DB.MSet(data)
+}
+
+func (db *instrumentedDB) WriteBatch(b *disk.Batch) error {
+	defer db.track("batch")()
+	return db.DB.WriteBatch(b)
+}
+
+func (db *instrumentedDB) Del(k string) error {
+	defer db.track("del")()
+	return db.DB.Del(k)
+}
+
+func (db *instrumentedDB) MDel(keys []string) error {
+	defer db.track("mdel")()
+	return db.DB.MDel(keys)
+}
+
+func (db *instrumentedDB) Scan(opt disk.ScannerOptions) error {
+	defer db.track("scan")()
+	return db.DB.Scan(opt)
+}
+
+func (db *instrumentedDB) GC() error {
+	defer db.track("gc")()
+	return db.DB.GC()
+}
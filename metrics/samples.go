@@ -0,0 +1,114 @@
+package metrics
+
+import (
+	"github.com/projectdiscovery/hmap/filekv"
+	"github.com/projectdiscovery/hmap/store/disk"
+	"github.com/projectdiscovery/hmap/store/hybrid"
+)
+
+// family - describes a metric
+type family struct {
+	help string
+	kind string
+}
+
+// latencyFamily is the histogram of the operation durations
+const latencyFamily = "hmap_operation_duration_seconds"
+
+var families = map[string]family{
+	"hmap_items":                   {"Number of live items.", "gauge"},
+	"hmap_bytes":                   {"Size of the keys and values of the live items.", "gauge"},
+	"hmap_disk_bytes":              {"Size of the store files.", "gauge"},
+	"hmap_expired_items":           {"Number of expired items not deleted yet.", "gauge"},
+	"hmap_hits_total":              {"Lookups finding the key, by tier.", "counter"},
+	"hmap_misses_total":            {"Lookups missing the key, by tier.", "counter"},
+	"hmap_hit_ratio":               {"Ratio of the lookups finding the key, by tier.", "gauge"},
+	"hmap_evictions_total":         {"Items evicted from the memory tier.", "counter"},
+	"hmap_spills_total":            {"Items moved from the memory tier to disk.", "counter"},
+	"hmap_disk_reads_total":        {"Records read from disk by lookups and scans.", "counter"},
+	"hmap_memory_guard_force_disk": {"Whether the memory guard forces writes to disk.", "gauge"},
+	"hmap_filekv_added_total":      {"Items merged into the file db.", "counter"},
+	"hmap_filekv_duped_total":      {"Duplicated items discarded by the file db.", "counter"},
+	"hmap_filekv_filtered_total":   {"Items filtered out by the file db.", "counter"},
+	latencyFamily:                  {"Duration of the store operations.", "histogram"},
+}
+
+// sample - represents a value of a metric, labeled with the store name once collected
+type sample struct {
+	family string
+	// label is the name of an optional extra label and value its value
+	label, value string
+	v            float64
+}
+
+func ratio(hits, misses uint64) float64 {
+	if hits+misses == 0 {
+		return 0
+	}
+	return float64(hits) / float64(hits+misses)
+}
+
+func lookupSamples(tier string, hits, misses uint64) []sample {
+	return []sample{
+		{family: "hmap_hits_total", label: "tier", value: tier, v: float64(hits)},
+		{family: "hmap_misses_total", label: "tier", value: tier, v: float64(misses)},
+		{family: "hmap_hit_ratio", label: "tier", value: tier, v: ratio(hits, misses)},
+	}
+}
+
+// dbSamples returns the samples of the counters of a db, cheap to collect on every scrape
+func dbSamples(counters disk.Stats) []sample {
+	samples := []sample{
+		{family: "hmap_disk_bytes", v: float64(counters.DiskBytes)},
+	}
+	return append(samples, lookupSamples("disk", counters.Hits, counters.Misses)...)
+}
+
+// dbItemSamples returns the samples of the records of a db, counted with a full scan
+func dbItemSamples(stats disk.Stats) []sample {
+	return []sample{
+		{family: "hmap_items", v: float64(stats.Items)},
+		{family: "hmap_bytes", v: float64(stats.Bytes)},
+		{family: "hmap_expired_items", v: float64(stats.Expired)},
+	}
+}
+
+// mapSamples returns the samples of the counters of a map, cheap to collect on every scrape
+func mapSamples(hm *hybrid.HybridMap) []sample {
+	counters := hm.Counters()
+	var forceDisk float64
+	if hm.MemoryGuardState() == hybrid.MemoryGuardForceDisk {
+		forceDisk = 1
+	}
+	samples := []sample{
+		{family: "hmap_disk_bytes", v: float64(counters.DiskBytes)},
+		{family: "hmap_evictions_total", v: float64(counters.Evictions)},
+		{family: "hmap_spills_total", v: float64(counters.Spills)},
+		{family: "hmap_disk_reads_total", v: float64(counters.DiskReads)},
+		{family: "hmap_memory_guard_force_disk", v: forceDisk},
+	}
+	samples = append(samples, lookupSamples("memory", counters.MemoryHits, counters.MemoryMisses)...)
+	return append(samples, lookupSamples("disk", counters.DiskHits, counters.DiskMisses)...)
+}
+
+// mapItemSamples returns the samples of the items of a map, counted with a full scan of its
+// disk store
+func mapItemSamples(hm *hybrid.HybridMap) []sample {
+	stats := hm.Stats()
+	return []sample{
+		{family: "hmap_items", v: float64(stats.Items)},
+		{family: "hmap_bytes", v: float64(stats.Bytes)},
+		{family: "hmap_expired_items", v: float64(stats.Expired)},
+	}
+}
+
+func fileDBSamples(fdb *filekv.FileDB) []sample {
+	stats := fdb.Stats()
+	return []sample{
+		{family: "hmap_items", v: float64(stats.NumberOfItems)},
+		{family: "hmap_disk_bytes", v: float64(fdb.Size())},
+		{family: "hmap_filekv_added_total", v: float64(stats.NumberOfAddedItems)},
+		{family: "hmap_filekv_duped_total", v: float64(stats.NumberOfDupedItems)},
+		{family: "hmap_filekv_filtered_total", v: float64(stats.NumberOfFilteredItems)},
+	}
+}
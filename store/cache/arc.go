@@ -0,0 +1,96 @@
+package cache
+
+// arcPolicy implements the Adaptive Replacement Cache algorithm. Resident keys are split
+// between t1 (seen once recently) and t2 (seen at least twice), while b1 and b2 keep the
+// ghosts of keys evicted from them to adapt the target size p of t1.
+// As the cache can be bounded by bytes, the resident count is used as the capacity
+type arcPolicy struct {
+	t1, t2, b1, b2 *keyList
+	p              int
+}
+
+func newARC() *arcPolicy {
+	return &arcPolicy{
+		t1: newKeyList(),
+		t2: newKeyList(),
+		b1: newKeyList(),
+		b2: newKeyList(),
+	}
+}
+
+func (p *arcPolicy) capacity() int {
+	return p.t1.len() + p.t2.len()
+}
+
+func (p *arcPolicy) add(k string) {
+	if p.t1.has(k) || p.t2.has(k) {
+		p.access(k)
+		return
+	}
+	switch {
+	case p.b1.has(k):
+		// recently evicted from t1: favour recency
+		delta := 1
+		if p.b1.len() > 0 && p.b2.len() > p.b1.len() {
+			delta = p.b2.len() / p.b1.len()
+		}
+		p.p = min(p.p+delta, p.capacity()+1)
+		p.b1.remove(k)
+		p.t2.pushFront(k)
+	case p.b2.has(k):
+		// recently evicted from t2: favour frequency
+		delta := 1
+		if p.b2.len() > 0 && p.b1.len() > p.b2.len() {
+			delta = p.b1.len() / p.b2.len()
+		}
+		p.p = max(p.p-delta, 0)
+		p.b2.remove(k)
+		p.t2.pushFront(k)
+	default:
+		p.t1.pushFront(k)
+	}
+}
+
+func (p *arcPolicy) access(k string) {
+	if p.t1.remove(k) {
+		p.t2.pushFront(k)
+		return
+	}
+	p.t2.moveToFront(k)
+}
+
+func (p *arcPolicy) remove(k string) {
+	if !p.t1.remove(k) {
+		p.t2.remove(k)
+	}
+}
+
+func (p *arcPolicy) victim() (string, bool) {
+	var (
+		k  string
+		ok bool
+	)
+	if p.t1.len() > 0 && (p.t1.len() > p.p || p.t2.len() == 0) {
+		if k, ok = p.t1.popBack(); ok {
+			p.b1.pushFront(k)
+		}
+	} else if k, ok = p.t2.popBack(); ok {
+		p.b2.pushFront(k)
+	}
+	// ghosts are bounded by the resident count
+	for c := max(p.capacity(), 1); p.b1.len() > c; {
+		p.b1.popBack()
+	}
+	for c := max(p.capacity(), 1); p.b2.len() > c; {
+		p.b2.popBack()
+	}
+	return k, ok
+}
+
+func (p *arcPolicy) reset() {
+	p.t1.reset()
+	p.t2.reset()
+	p.b1.reset()
+	p.b2.reset()
+	p.p = 0
+}
@@ -2,6 +2,7 @@ package cache
 
 import (
 	"runtime"
+	"sort"
 	"sync"
 	"time"
 )
@@ -15,98 +16,254 @@ type Cache interface {
 	SetWithExpiration(string, interface{}, time.Duration)
 	Set(string, interface{})
 	Get(string) (interface{}, bool)
+	GetWithExpiration(string) (interface{}, time.Time, bool)
+	Peek(string) (interface{}, time.Time, bool)
 	Delete(string)
 	DeleteExpired()
 	OnEvicted(func(string, interface{}))
+	Subscribe(EvictionHandler) func()
 	CloneItems() map[string]Item
-	Scan(func([]byte, []byte) error)
+	Scan(func([]byte, []byte) error) error
+	ScanValues(func(string, interface{}) error) error
 	ItemCount() int
+	Bytes() int64
+	Shrink(int64) int
+	Stats() Stats
+	Counters() Stats
 }
 
 type CacheMemory struct {
 	*cacheMemory
 }
 
+// Options - represents the options of a memory cache
+type Options struct {
+	DefaultExpiration time.Duration
+	CleanupInterval   time.Duration
+	// MaxItems bounds the number of items held by the cache, 0 means unbounded
+	MaxItems int
+	// MaxBytes bounds the size of the keys and values held by the cache, 0 means unbounded
+	MaxBytes int64
+	// EvictionPolicy selects the items to evict when one of the bounds is exceeded
+	EvictionPolicy EvictionPolicy
+	// ExpirationMode selects how items set with the default expiration expire, items set
+	// with an explicit expiration always expire at an absolute time
+	ExpirationMode ExpirationMode
+	// MaxLifetime bounds the lifetime of sliding items in SlidingWithMaxLifetime mode
+	MaxLifetime time.Duration
+	// Shards is the number of partitions of a sharded cache, rounded up to a power of two and
+	// lowered to fit MaxItems and MaxBytes. 0 means four per CPU
+	Shards int
+}
+
 type cacheMemory struct {
 	DefaultExpiration time.Duration
 	Items             map[string]Item
 	mu                sync.RWMutex
-	onEvicted         func(string, interface{})
+	listeners         listeners
 	janitor           *janitor
+	maxItems          int
+	maxBytes          int64
+	bytes             int64
+	policy            policy
+	counters          counters
+	mode              ExpirationMode
+	maxLifetime       time.Duration
 }
 
 func (c *cacheMemory) SetWithExpiration(k string, x interface{}, d time.Duration) {
 	c.mu.Lock()
-	defer c.mu.Unlock()
-	c.set(k, x, d)
+	evictedItems := c.set(k, x, d)
+	l := c.listeners
+	c.mu.Unlock()
+	l.notify(evictedItems)
 }
 
-func (c *cacheMemory) set(k string, x interface{}, d time.Duration) {
-	var e int64
+func (c *cacheMemory) set(k string, x interface{}, d time.Duration) []keyAndValue {
+	now := time.Now()
+	item := Item{
+		Object:  x,
+		Created: now.UnixNano(),
+	}
 	if d == DefaultExpiration {
 		d = c.DefaultExpiration
+		if c.mode != Absolute && d > 0 {
+			item.TTL = d
+		}
+	}
+	if item.TTL > 0 {
+		item.Expiration = c.slide(item, now)
+	} else if d > 0 {
+		item.Expiration = now.Add(d).UnixNano()
+	}
+	return c.put(k, item)
+}
+
+// put stores an item, returning the replaced and evicted ones
+func (c *cacheMemory) put(k string, item Item) []keyAndValue {
+	var evictedItems []keyAndValue
+	old, exists := c.Items[k]
+	if exists {
+		c.bytes -= itemSize(k, old.Object)
+		if !c.listeners.empty() {
+			evictedItems = append(evictedItems, keyAndValue{k, old.Object, Replaced})
+		}
+	}
+	c.Items[k] = item
+	c.bytes += itemSize(k, item.Object)
+
+	if c.policy == nil {
+		return evictedItems
+	}
+	if exists {
+		c.policy.access(k)
+	} else {
+		c.policy.add(k)
+	}
+	return append(evictedItems, c.evictOverflow()...)
+}
+
+func (c *cacheMemory) overflow() bool {
+	return (c.maxItems > 0 && len(c.Items) > c.maxItems) || (c.maxBytes > 0 && c.bytes > c.maxBytes)
+}
+
+// evictOverflow removes the victims designated by the policy until the cache fits its bounds
+func (c *cacheMemory) evictOverflow() []keyAndValue {
+	return c.evictWhile(c.overflow)
+}
+
+// evictWhile removes the victims designated by the policy as long as cond holds
+func (c *cacheMemory) evictWhile(cond func() bool) []keyAndValue {
+	var evictedItems []keyAndValue
+	for cond() {
+		k, ok := c.policy.victim()
+		if !ok {
+			break
+		}
+		item, found := c.Items[k]
+		if !found {
+			continue
+		}
+		delete(c.Items, k)
+		c.bytes -= itemSize(k, item.Object)
+		c.counters.evictions.Add(1)
+		evictedItems = append(evictedItems, keyAndValue{k, item.Object, Capacity})
 	}
-	if d > 0 {
-		e = time.Now().Add(d).UnixNano()
+	return evictedItems
+}
+
+// itemSize returns the number of bytes accounted for an item
+func itemSize(k string, x interface{}) int64 {
+	size := int64(len(k))
+	switch v := x.(type) {
+	case []byte:
+		size += int64(len(v))
+	case string:
+		size += int64(len(v))
 	}
-	c.Items[k] = Item{
-		Object:     x,
-		Expiration: e,
+	return size
+}
+
+// slide returns the expiration of a sliding item accessed at now
+func (c *cacheMemory) slide(item Item, now time.Time) int64 {
+	e := now.Add(item.TTL).UnixNano()
+	if c.mode == SlidingWithMaxLifetime && c.maxLifetime > 0 {
+		if limit := item.Created + int64(c.maxLifetime); e > limit {
+			e = limit
+		}
 	}
+	return e
 }
 
 func (c *cacheMemory) Set(k string, x interface{}) {
-	c.SetWithExpiration(k, x, c.DefaultExpiration)
+	c.SetWithExpiration(k, x, DefaultExpiration)
 }
 
+// Get returns an unexpired item, sliding its expiration
 func (c *cacheMemory) Get(k string) (interface{}, bool) {
 	c.mu.RLock()
 	item, found := c.Items[k]
-	if !found {
-		c.mu.RUnlock()
+	c.mu.RUnlock()
+	if !found || item.Expired() {
+		c.counters.misses.Add(1)
 		return nil, false
 	}
-	if item.Expiration > 0 {
-		if time.Now().UnixNano() > item.Expiration {
-			c.mu.RUnlock()
-			return nil, false
-		}
-	}
-	c.mu.RUnlock()
+	c.counters.hits.Add(1)
 	c.refresh(k)
 	return item.Object, true
 }
 
+// GetWithExpiration returns an item and its expiration time, which is the zero time
+// if the item never expires. It doesn't slide the expiration
+func (c *cacheMemory) GetWithExpiration(k string) (interface{}, time.Time, bool) {
+	v, expiration, ok := c.Peek(k)
+	if ok {
+		c.counters.hits.Add(1)
+	} else {
+		c.counters.misses.Add(1)
+	}
+	return v, expiration, ok
+}
+
+// Peek returns an unexpired item and its expiration time like GetWithExpiration, without
+// counting the lookup in the stats nor recording an access
+func (c *cacheMemory) Peek(k string) (interface{}, time.Time, bool) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	item, found := c.Items[k]
+	if !found || item.Expired() {
+		return nil, time.Time{}, false
+	}
+	if item.Expiration > 0 {
+		return item.Object, time.Unix(0, item.Expiration), true
+	}
+	return item.Object, time.Time{}, true
+}
+
+// refresh records an access to k, sliding its expiration
 func (c *cacheMemory) refresh(k string) bool {
+	if c.mode == Absolute && c.policy == nil {
+		return true
+	}
 	c.mu.Lock()
 	defer c.mu.Unlock()
 
 	item, found := c.Items[k]
-	if !found {
+	if !found || item.Expired() {
 		return false
 	}
-	item.Expiration = time.Now().Add(c.DefaultExpiration).UnixNano()
+	if item.TTL > 0 {
+		item.Expiration = c.slide(item, time.Now())
+		c.Items[k] = item
+	}
+	if c.policy != nil {
+		c.policy.access(k)
+	}
 	return true
 }
 
 func (c *cacheMemory) Delete(k string) {
 	c.mu.Lock()
-	v, evicted := c.delete(k)
+	v, found := c.delete(k)
+	l := c.listeners
 	c.mu.Unlock()
-	if evicted {
-		c.onEvicted(k, v)
+	if found {
+		l.notify([]keyAndValue{{k, v, Deleted}})
 	}
 }
 
+// delete removes k and returns its value if found
 func (c *cacheMemory) delete(k string) (interface{}, bool) {
-	if c.onEvicted != nil {
-		if v, found := c.Items[k]; found {
-			delete(c.Items, k)
-			return v.Object, true
-		}
+	v, found := c.Items[k]
+	if !found {
+		return nil, false
 	}
 	delete(c.Items, k)
-	return nil, false
+	c.bytes -= itemSize(k, v.Object)
+	if c.policy != nil {
+		c.policy.remove(k)
+	}
+	return v.Object, true
 }
 
 // Delete all expired items from the cache.
@@ -117,33 +274,24 @@ func (c *cacheMemory) DeleteExpired() {
 	for k, v := range c.Items {
 		// "Inlining" of expired
 		if v.Expiration > 0 && now > v.Expiration {
-			ov, evicted := c.delete(k)
-			if evicted {
-				evictedItems = append(evictedItems, keyAndValue{k, ov})
+			c.counters.expirations.Add(1)
+			ov, _ := c.delete(k)
+			if !c.listeners.empty() {
+				evictedItems = append(evictedItems, keyAndValue{k, ov, Expired})
 			}
 		}
 	}
+	l := c.listeners
 	c.mu.Unlock()
-	for _, v := range evictedItems {
-		c.onEvicted(v.key, v.value)
-	}
+	l.notify(evictedItems)
 }
 
+// OnEvicted sets the callback notified of the expired, deleted and capacity evicted items,
+// Subscribe also reports the reason
 func (c *cacheMemory) OnEvicted(f func(string, interface{})) {
 	c.mu.Lock()
 	defer c.mu.Unlock()
-	c.onEvicted = f
-}
-
-func (c *cacheMemory) Scan(f func([]byte, []byte) error) {
-	c.mu.Lock()
-	defer c.mu.Unlock()
-
-	for k, item := range c.Items {
-		if f([]byte(k), item.Object.([]byte)) != nil {
-			break
-		}
-	}
+	c.listeners.onEvicted = f
 }
 
 func (c *cacheMemory) CloneItems() map[string]Item {
@@ -173,9 +321,64 @@ func (c *cacheMemory) ItemCount() int {
 
 func (c *cacheMemory) Empty() {
 	c.mu.Lock()
-	defer c.mu.Unlock()
-
+	var evictedItems []keyAndValue
+	if len(c.listeners.handlers) > 0 {
+		for k, item := range c.Items {
+			evictedItems = append(evictedItems, keyAndValue{k, item.Object, Cleared})
+		}
+	}
 	c.Items = map[string]Item{}
+	c.bytes = 0
+	if c.policy != nil {
+		c.policy.reset()
+	}
+	l := c.listeners
+	c.mu.Unlock()
+	l.notify(evictedItems)
+}
+
+// Shrink evicts the coldest items until the cache holds at most target bytes and returns
+// the number of evicted items. Items are chosen by the eviction policy of bounded caches,
+// otherwise by nearest expiration, the items which never expire going last
+func (c *cacheMemory) Shrink(target int64) int {
+	c.mu.Lock()
+	var evictedItems []keyAndValue
+	if c.policy != nil {
+		evictedItems = c.evictWhile(func() bool { return c.bytes > target })
+	} else if c.bytes > target {
+		keys := make([]string, 0, len(c.Items))
+		for k := range c.Items {
+			keys = append(keys, k)
+		}
+		sort.Slice(keys, func(i, j int) bool {
+			ei, ej := c.Items[keys[i]].Expiration, c.Items[keys[j]].Expiration
+			if ei == 0 || ej == 0 {
+				return ej == 0 && ei != 0
+			}
+			return ei < ej
+		})
+		for _, k := range keys {
+			if c.bytes <= target {
+				break
+			}
+			item := c.Items[k]
+			delete(c.Items, k)
+			c.bytes -= itemSize(k, item.Object)
+			c.counters.evictions.Add(1)
+			evictedItems = append(evictedItems, keyAndValue{k, item.Object, Capacity})
+		}
+	}
+	l := c.listeners
+	c.mu.Unlock()
+	l.notify(evictedItems)
+	return len(evictedItems)
+}
+
+// Bytes returns the size of the keys and values held by the cache
+func (c *cacheMemory) Bytes() int64 {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return c.bytes
 }
 
 func newCache(de time.Duration, m map[string]Item) *cacheMemory {
@@ -186,11 +389,17 @@ func newCache(de time.Duration, m map[string]Item) *cacheMemory {
 		DefaultExpiration: de,
 		Items:             m,
 	}
+	for k, v := range m {
+		c.bytes += itemSize(k, v.Object)
+	}
 	return c
 }
 
 func newCacheWithJanitor(de time.Duration, ci time.Duration, m map[string]Item) *CacheMemory {
-	c := newCache(de, m)
+	return wrapWithJanitor(newCache(de, m), ci)
+}
+
+func wrapWithJanitor(c *cacheMemory, ci time.Duration) *CacheMemory {
 	w := &CacheMemory{
 		cacheMemory: c,
 	}
@@ -208,6 +417,23 @@ func New(defaultExpiration, cleanupInterval time.Duration) *CacheMemory {
 	return newCacheWithJanitor(defaultExpiration, cleanupInterval, items)
 }
 
+// NewWithOptions creates a memory cache which can be bounded in number of items and bytes
+func NewWithOptions(options Options) *CacheMemory {
+	return wrapWithJanitor(newCacheWithOptions(options), options.CleanupInterval)
+}
+
+func newCacheWithOptions(options Options) *cacheMemory {
+	c := newCache(options.DefaultExpiration, make(map[string]Item))
+	c.mode = options.ExpirationMode
+	c.maxLifetime = options.MaxLifetime
+	if options.MaxItems > 0 || options.MaxBytes > 0 {
+		c.maxItems = options.MaxItems
+		c.maxBytes = options.MaxBytes
+		c.policy = newPolicy(options.EvictionPolicy)
+	}
+	return c
+}
+
 func NewFrom(defaultExpiration, cleanupInterval time.Duration, items map[string]Item) *CacheMemory {
 	return newCacheWithJanitor(defaultExpiration, cleanupInterval, items)
 }
@@ -0,0 +1,392 @@
+package cache
+
+import (
+	"bytes"
+	"fmt"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestBoundedItems(t *testing.T) {
+	for _, p := range []EvictionPolicy{LRU, LFU, ARC, WTinyLFU} {
+		c := NewWithOptions(Options{MaxItems: 10, EvictionPolicy: p})
+		var evicted int
+		c.OnEvicted(func(string, interface{}) {
+			evicted++
+		})
+		for i := 0; i < 100; i++ {
+			c.Set(fmt.Sprint(i), []byte("value"))
+		}
+		require.Equal(t, 10, c.ItemCount(), "policy %d", p)
+		require.Equal(t, 90, evicted, "policy %d", p)
+	}
+}
+
+func TestBoundedBytes(t *testing.T) {
+	c := NewWithOptions(Options{MaxBytes: 100})
+	for i := 0; i < 100; i++ {
+		c.Set(fmt.Sprintf("%03d", i), []byte("1234567"))
+	}
+	require.LessOrEqual(t, c.Bytes(), int64(100))
+	require.Equal(t, 10, c.ItemCount())
+	_, ok := c.Get("099")
+	require.True(t, ok)
+	_, ok = c.Get("000")
+	require.False(t, ok)
+}
+
+func TestFrequencyAwarePolicies(t *testing.T) {
+	for _, p := range []EvictionPolicy{LRU, LFU, ARC, WTinyLFU} {
+		c := NewWithOptions(Options{MaxItems: 10, EvictionPolicy: p})
+		c.Set("hot", []byte("value"))
+		for i := 0; i < 20; i++ {
+			_, _ = c.Get("hot")
+		}
+		// one-hit scan
+		for i := 0; i < 100; i++ {
+			c.Set(fmt.Sprint(i), []byte("value"))
+		}
+		_, ok := c.Get("hot")
+		if p == LRU {
+			require.False(t, ok, "lru should evict the hot key on scan")
+		} else {
+			require.True(t, ok, "policy %d should retain the hot key", p)
+		}
+	}
+}
+
+func TestSketchGrow(t *testing.T) {
+	s := newCountMinSketch(sketchMinWidth)
+	for i := 0; i < 5; i++ {
+		s.increment("hot")
+	}
+	s.increment("cold")
+	g := s.grow(4 * sketchMinWidth)
+	require.Equal(t, 4*sketchMinWidth, g.width())
+	require.Equal(t, s.estimate("hot"), g.estimate("hot"))
+	require.Equal(t, s.estimate("cold"), g.estimate("cold"))
+}
+
+func TestShrink(t *testing.T) {
+	c := New(NoExpiration, 0)
+	c.SetWithExpiration("keep", []byte("v"), NoExpiration)
+	c.SetWithExpiration("late", []byte("v"), time.Hour)
+	c.SetWithExpiration("soon", []byte("v"), time.Minute)
+	itemBytes := c.Bytes() / 3
+
+	// the nearest expiration goes first and the items which never expire last
+	require.Equal(t, 1, c.Shrink(2*itemBytes))
+	_, ok := c.Get("soon")
+	require.False(t, ok)
+	require.Equal(t, 1, c.Shrink(itemBytes))
+	_, ok = c.Get("late")
+	require.False(t, ok)
+	_, ok = c.Get("keep")
+	require.True(t, ok)
+}
+
+func TestStats(t *testing.T) {
+	c := NewWithOptions(Options{MaxItems: 10, EvictionPolicy: LRU})
+	for i := 0; i < 15; i++ {
+		c.Set(fmt.Sprint(i), []byte("value"))
+	}
+	c.SetWithExpiration("expiring", []byte("value"), time.Millisecond)
+	_, _ = c.Get("14")
+	_, _ = c.Get("0")
+	time.Sleep(5 * time.Millisecond)
+	_, _ = c.Get("expiring")
+
+	stats := c.Stats()
+	require.Equal(t, 10, stats.Items)
+	require.Equal(t, c.Bytes(), stats.Bytes)
+	require.Equal(t, 1, stats.Expired)
+	require.Equal(t, uint64(1), stats.Hits)
+	require.Equal(t, uint64(2), stats.Misses)
+	require.Equal(t, uint64(6), stats.Evictions)
+
+	counters := c.Counters()
+	require.Zero(t, counters.Expired)
+	stats.Expired = 0
+	require.Equal(t, stats, counters)
+
+	c.DeleteExpired()
+	stats = c.Stats()
+	require.Zero(t, stats.Expired)
+	require.Equal(t, uint64(1), stats.Expirations)
+}
+
+func TestShardedShrink(t *testing.T) {
+	c := NewSharded(Options{Shards: 2, EvictionPolicy: LRU})
+	// fill one shard with ten items and the other with two, all of the same size
+	counts := make(map[*cacheMemory]int)
+	for i := 0; len(counts) < 2 || counts[c.shards[0]] < 10 || counts[c.shards[1]] < 2; i++ {
+		k := fmt.Sprintf("key-%03d", i)
+		shard := c.shard(k)
+		if (shard == c.shards[0] && counts[shard] < 10) || (shard == c.shards[1] && counts[shard] < 2) {
+			c.Set(k, []byte("value"))
+			counts[shard]++
+		}
+	}
+	itemBytes := c.Bytes() / 12
+
+	// evicting two items must not cut the fuller shard down to half the target
+	target := 10 * itemBytes
+	evicted := c.Shrink(target)
+	require.LessOrEqual(t, c.Bytes(), target)
+	require.LessOrEqual(t, evicted, 3)
+	require.Zero(t, c.Shrink(c.Bytes()))
+}
+
+func TestSharded(t *testing.T) {
+	c := NewSharded(Options{Shards: 5, MaxItems: 80, EvictionPolicy: LRU})
+	require.Equal(t, 8, c.Shards())
+	var _ Cache = c
+
+	for i := 0; i < 1000; i++ {
+		c.Set(fmt.Sprint(i), []byte("value"))
+	}
+	require.LessOrEqual(t, c.ItemCount(), 80)
+	require.Equal(t, c.ItemCount(), len(c.CloneItems()))
+	v, ok := c.Get("999")
+	require.True(t, ok)
+	require.Equal(t, []byte("value"), v)
+
+	var keys int
+	for range c.Keys() {
+		keys++
+	}
+	require.Equal(t, c.ItemCount(), keys)
+
+	c.SetWithExpiration("expiring", []byte("value"), time.Millisecond)
+	time.Sleep(5 * time.Millisecond)
+	_, ok = c.Get("expiring")
+	require.False(t, ok)
+	c.DeleteExpired()
+
+	c.Delete("999")
+	_, ok = c.Get("999")
+	require.False(t, ok)
+	stats := c.Stats()
+	require.Equal(t, uint64(1), stats.Hits)
+	require.Equal(t, uint64(2), stats.Misses)
+	require.Equal(t, uint64(1), stats.Expirations)
+	require.Equal(t, c.Bytes(), stats.Bytes)
+
+	c.Shrink(0)
+	require.Zero(t, c.ItemCount())
+}
+
+func TestShardedBounds(t *testing.T) {
+	// a small bound lowers the shard count and is never exceeded
+	c := NewSharded(Options{Shards: 64, MaxItems: 10, EvictionPolicy: LRU})
+	require.Equal(t, 8, c.Shards())
+	for i := 0; i < 1000; i++ {
+		c.Set(fmt.Sprint(i), []byte("value"))
+	}
+	require.LessOrEqual(t, c.ItemCount(), 10)
+
+	c = NewSharded(Options{Shards: 64, MaxBytes: 100, EvictionPolicy: LRU})
+	require.Equal(t, 64, c.Shards())
+	for i := 0; i < 1000; i++ {
+		c.Set(fmt.Sprint(i), []byte("value"))
+	}
+	require.LessOrEqual(t, c.Bytes(), int64(100))
+
+	c = NewSharded(Options{Shards: 64, MaxBytes: 3})
+	require.Equal(t, 2, c.Shards())
+}
+
+func benchmarkParallel(b *testing.B, c Cache, writes int) {
+	keys := make([]string, 1024)
+	for i := range keys {
+		keys[i] = fmt.Sprint(i)
+		c.Set(keys[i], []byte("value"))
+	}
+	b.ResetTimer()
+	b.RunParallel(func(pb *testing.PB) {
+		i := 0
+		for pb.Next() {
+			k := keys[i&1023]
+			if writes > 0 && i%writes == 0 {
+				c.Set(k, []byte("value"))
+			} else {
+				_, _ = c.Get(k)
+			}
+			i++
+		}
+	})
+}
+
+func BenchmarkGetParallel(b *testing.B) {
+	b.Run("single", func(b *testing.B) { benchmarkParallel(b, NewWithOptions(Options{}), 0) })
+	b.Run("sharded", func(b *testing.B) { benchmarkParallel(b, NewSharded(Options{}), 0) })
+}
+
+func BenchmarkMixedParallel(b *testing.B) {
+	b.Run("single", func(b *testing.B) { benchmarkParallel(b, NewWithOptions(Options{}), 4) })
+	b.Run("sharded", func(b *testing.B) { benchmarkParallel(b, NewSharded(Options{}), 4) })
+}
+
+func TestExpirationModes(t *testing.T) {
+	const ttl = 100 * time.Millisecond
+	// readEvery reads k every interval during d, returning false once it misses
+	readEvery := func(c Cache, k string, interval, d time.Duration) bool {
+		for deadline := time.Now().Add(d); time.Now().Before(deadline); {
+			time.Sleep(interval)
+			if _, ok := c.Get(k); !ok {
+				return false
+			}
+		}
+		return true
+	}
+
+	t.Run("absolute", func(t *testing.T) {
+		c := NewWithOptions(Options{DefaultExpiration: ttl})
+		c.Set("k", []byte("v"))
+		require.False(t, readEvery(c, "k", 30*time.Millisecond, 3*ttl))
+	})
+
+	t.Run("sliding", func(t *testing.T) {
+		c := NewWithOptions(Options{DefaultExpiration: ttl, ExpirationMode: Sliding})
+		c.Set("k", []byte("v"))
+		c.Set("idle", []byte("v"))
+		c.SetWithExpiration("explicit", []byte("v"), ttl)
+		require.True(t, readEvery(c, "k", 30*time.Millisecond, 3*ttl))
+		c.DeleteExpired()
+		require.Equal(t, 1, c.ItemCount())
+		time.Sleep(2 * ttl)
+		_, ok := c.Get("k")
+		require.False(t, ok)
+	})
+
+	t.Run("sliding with max lifetime", func(t *testing.T) {
+		c := NewWithOptions(Options{DefaultExpiration: ttl, ExpirationMode: SlidingWithMaxLifetime, MaxLifetime: 3 * ttl})
+		c.Set("k", []byte("v"))
+		require.True(t, readEvery(c, "k", 30*time.Millisecond, 2*ttl))
+		_, expiration, ok := c.GetWithExpiration("k")
+		require.True(t, ok)
+		require.Equal(t, c.CloneItems()["k"].Created+int64(3*ttl), expiration.UnixNano())
+		require.False(t, readEvery(c, "k", 30*time.Millisecond, 3*ttl))
+	})
+}
+
+func TestEvictionReasons(t *testing.T) {
+	c := NewWithOptions(Options{MaxItems: 2, EvictionPolicy: LRU})
+	var legacy []string
+	c.OnEvicted(func(k string, _ interface{}) {
+		legacy = append(legacy, k)
+	})
+	reasons := make(map[string]EvictionReason)
+	unsubscribe := c.Subscribe(func(k string, _ interface{}, reason EvictionReason) {
+		reasons[k] = reason
+	})
+	var others int
+	c.Subscribe(func(string, interface{}, EvictionReason) {
+		others++
+	})
+
+	c.Set("replaced", []byte("v1"))
+	c.Set("replaced", []byte("v2"))
+	c.Set("deleted", []byte("v"))
+	c.Delete("deleted")
+	c.Set("capacity", []byte("v"))
+	c.Set("other", []byte("v"))
+	c.SetWithExpiration("expired", []byte("v"), time.Millisecond)
+	time.Sleep(5 * time.Millisecond)
+	c.DeleteExpired()
+	c.Set("cleared", []byte("v"))
+	c.Empty()
+
+	require.Equal(t, map[string]EvictionReason{
+		"replaced": Capacity,
+		"deleted":  Deleted,
+		"capacity": Capacity,
+		"other":    Cleared,
+		"expired":  Expired,
+		"cleared":  Cleared,
+	}, reasons)
+	require.Equal(t, 7, others)
+	require.Equal(t, []string{"deleted", "replaced", "capacity", "expired"}, legacy)
+
+	unsubscribe()
+	c.Set("k", []byte("v"))
+	c.Delete("k")
+	require.NotContains(t, reasons, "k")
+	require.Equal(t, 8, others)
+	require.Equal(t, "replaced", Replaced.String())
+}
+
+func TestSnapshot(t *testing.T) {
+	c := NewWithOptions(Options{DefaultExpiration: time.Hour, ExpirationMode: Sliding})
+	c.Set("bytes", []byte("value"))
+	c.Set("string", "value")
+	c.SetWithExpiration("persisted", []byte("value"), NoExpiration)
+	c.SetWithExpiration("expiring", []byte("value"), 50*time.Millisecond)
+	path := filepath.Join(t.TempDir(), "cache.snapshot")
+	require.Nil(t, c.SaveFile(path))
+	time.Sleep(60 * time.Millisecond)
+
+	loaded := NewSharded(Options{Shards: 4})
+	require.Nil(t, loaded.LoadFile(path))
+	require.Equal(t, 3, loaded.ItemCount())
+	original := c.CloneItems()
+	for k, item := range loaded.CloneItems() {
+		require.Equal(t, original[k], item, "key %s", k)
+	}
+	_, ok := loaded.Get("expiring")
+	require.False(t, ok)
+
+	var buf bytes.Buffer
+	require.Nil(t, loaded.Save(&buf))
+	snapshot := buf.Bytes()
+	restored := New(NoExpiration, 0)
+	require.Nil(t, restored.Load(bytes.NewReader(snapshot)))
+	require.Equal(t, 3, restored.ItemCount())
+
+	corrupted := bytes.Clone(snapshot)
+	corrupted[len(corrupted)/2] ^= 0xff
+	empty := New(NoExpiration, 0)
+	require.ErrorIs(t, empty.Load(bytes.NewReader(corrupted)), ErrInvalidSnapshot)
+	require.ErrorIs(t, empty.Load(bytes.NewReader(snapshot[:len(snapshot)-1])), ErrInvalidSnapshot)
+	require.Zero(t, empty.ItemCount())
+
+	c.Set("unsupported", 42)
+	require.ErrorIs(t, c.Save(&buf), ErrUnsupportedValue)
+}
+
+func TestScan(t *testing.T) {
+	for name, c := range map[string]Cache{"single": New(NoExpiration, 0), "sharded": NewSharded(Options{})} {
+		t.Run(name, func(t *testing.T) {
+			c.Set("bytes", []byte("value"))
+			c.Set("string", "value")
+			c.SetWithExpiration("expired", []byte("value"), time.Millisecond)
+			time.Sleep(5 * time.Millisecond)
+
+			values := make(map[string]interface{})
+			require.Nil(t, c.ScanValues(func(k string, v interface{}) error {
+				// writers aren't blocked by the scan
+				c.Set("written", []byte("value"))
+				values[k] = v
+				return nil
+			}))
+			require.Equal(t, map[string]interface{}{"bytes": []byte("value"), "string": "value"}, values)
+			c.Delete("written")
+
+			require.ErrorIs(t, c.Scan(func(k, v []byte) error { return nil }), ErrValueType)
+			require.ErrorIs(t, ScanAs(c, func(k string, v string) error { return nil }), ErrValueType)
+
+			c.Delete("string")
+			var keys []string
+			require.Nil(t, c.Scan(func(k, v []byte) error {
+				keys = append(keys, string(k))
+				return nil
+			}))
+			require.Equal(t, []string{"bytes"}, keys)
+			stop := fmt.Errorf("stop")
+			require.ErrorIs(t, ScanAs(c, func(k string, v []byte) error { return stop }), stop)
+		})
+	}
+}
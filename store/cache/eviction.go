@@ -0,0 +1,82 @@
+package cache
+
+import "slices"
+
+// EvictionReason tells why an item left the cache
+type EvictionReason int
+
+const (
+	// Expired items were removed by DeleteExpired, past their expiration
+	Expired EvictionReason = iota
+	// Deleted items were removed by Delete
+	Deleted
+	// Capacity items were evicted to fit the bounds of the cache or by Shrink
+	Capacity
+	// Replaced items were overwritten by a new value for the same key
+	Replaced
+	// Cleared items were removed by Empty
+	Cleared
+)
+
+func (r EvictionReason) String() string {
+	switch r {
+	case Expired:
+		return "expired"
+	case Deleted:
+		return "deleted"
+	case Capacity:
+		return "capacity"
+	case Replaced:
+		return "replaced"
+	case Cleared:
+		return "cleared"
+	default:
+		return "unknown"
+	}
+}
+
+// EvictionHandler - is notified of an item leaving the cache
+type EvictionHandler func(k string, v interface{}, reason EvictionReason)
+
+type subscription struct {
+	handler EvictionHandler
+}
+
+// listeners holds the eviction callbacks of a cache. The handlers slice is copied on write
+// so that a snapshot taken under the cache lock can be notified after releasing it
+type listeners struct {
+	// onEvicted is the legacy callback, not notified of Replaced and Cleared items
+	onEvicted func(string, interface{})
+	handlers  []*subscription
+}
+
+func (l listeners) empty() bool {
+	return l.onEvicted == nil && len(l.handlers) == 0
+}
+
+func (l listeners) notify(items []keyAndValue) {
+	for _, item := range items {
+		if l.onEvicted != nil && item.reason != Replaced && item.reason != Cleared {
+			l.onEvicted(item.key, item.value)
+		}
+		for _, s := range l.handlers {
+			s.handler(item.key, item.value, item.reason)
+		}
+	}
+}
+
+// Subscribe - registers a handler notified of every item leaving the cache along with
+// the reason, and returns a function unregistering it
+func (c *cacheMemory) Subscribe(h EvictionHandler) func() {
+	s := &subscription{handler: h}
+	c.mu.Lock()
+	c.listeners.handlers = append(slices.Clip(c.listeners.handlers), s)
+	c.mu.Unlock()
+	return func() {
+		c.mu.Lock()
+		defer c.mu.Unlock()
+		c.listeners.handlers = slices.DeleteFunc(slices.Clone(c.listeners.handlers), func(x *subscription) bool {
+			return x == s
+		})
+	}
+}
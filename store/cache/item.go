@@ -2,9 +2,26 @@ package cache
 
 import "time"
 
+// ExpirationMode selects how the items set with the default expiration expire
+type ExpirationMode int
+
+const (
+	// Absolute expires items the default expiration after they are set
+	Absolute ExpirationMode = iota
+	// Sliding expires items the default expiration after they are last read
+	Sliding
+	// SlidingWithMaxLifetime slides the expiration like Sliding, but never past
+	// MaxLifetime after the item is set
+	SlidingWithMaxLifetime
+)
+
 type Item struct {
 	Object     interface{}
 	Expiration int64
+	// Created is the time the item was set in unix nanoseconds
+	Created int64
+	// TTL is the window the expiration slides by on access, 0 for items expiring at an absolute time
+	TTL time.Duration
 }
 
 func (item Item) Expired() bool {
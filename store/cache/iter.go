@@ -0,0 +1,69 @@
+package cache
+
+import (
+	"iter"
+	"strings"
+)
+
+// All - returns an iterator over a snapshot of the unexpired items holding []byte values
+func (c *cacheMemory) All() iter.Seq2[[]byte, []byte] {
+	return c.Prefix("")
+}
+
+// Keys - returns an iterator over a snapshot of the unexpired keys
+func (c *cacheMemory) Keys() iter.Seq[[]byte] {
+	return func(yield func([]byte) bool) {
+		for k := range c.CloneItems() {
+			if !yield([]byte(k)) {
+				return
+			}
+		}
+	}
+}
+
+// Prefix - returns an iterator over a snapshot of the unexpired items whose key starts with p
+func (c *cacheMemory) Prefix(p string) iter.Seq2[[]byte, []byte] {
+	return func(yield func([]byte, []byte) bool) {
+		for k, item := range c.CloneItems() {
+			v, ok := item.Object.([]byte)
+			if !ok || !strings.HasPrefix(k, p) {
+				continue
+			}
+			if !yield([]byte(k), v) {
+				return
+			}
+		}
+	}
+}
+
+// All - returns an iterator over a snapshot of the unexpired items holding []byte values
+func (sc *shardedCache) All() iter.Seq2[[]byte, []byte] {
+	return sc.Prefix("")
+}
+
+// Keys - returns an iterator over a snapshot of the unexpired keys, taken shard by shard
+func (sc *shardedCache) Keys() iter.Seq[[]byte] {
+	return func(yield func([]byte) bool) {
+		for _, c := range sc.shards {
+			for k := range c.Keys() {
+				if !yield(k) {
+					return
+				}
+			}
+		}
+	}
+}
+
+// Prefix - returns an iterator over a snapshot of the unexpired items whose key starts with p,
+// taken shard by shard
+func (sc *shardedCache) Prefix(p string) iter.Seq2[[]byte, []byte] {
+	return func(yield func([]byte, []byte) bool) {
+		for _, c := range sc.shards {
+			for k, v := range c.Prefix(p) {
+				if !yield(k, v) {
+					return
+				}
+			}
+		}
+	}
+}
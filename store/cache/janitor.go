@@ -9,7 +9,12 @@ type janitor struct {
 	stop     chan struct{}
 }
 
-func (j *janitor) Run(c *cacheMemory) {
+// expirer is implemented by the caches cleaned up by a janitor
+type expirer interface {
+	DeleteExpired()
+}
+
+func (j *janitor) Run(c expirer) {
 	ticker := time.NewTicker(j.Interval)
 	for {
 		select {
@@ -1,6 +1,7 @@
 package cache
 
 type keyAndValue struct {
-	key   string
-	value interface{}
+	key    string
+	value  interface{}
+	reason EvictionReason
 }
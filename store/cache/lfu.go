@@ -0,0 +1,98 @@
+package cache
+
+import "container/heap"
+
+type lfuEntry struct {
+	key   string
+	freq  uint64
+	tick  uint64
+	index int
+}
+
+// lfuHeap orders entries by frequency, then by last access
+type lfuHeap []*lfuEntry
+
+func (h lfuHeap) Len() int { return len(h) }
+
+func (h lfuHeap) Less(i, j int) bool {
+	if h[i].freq == h[j].freq {
+		return h[i].tick < h[j].tick
+	}
+	return h[i].freq < h[j].freq
+}
+
+func (h lfuHeap) Swap(i, j int) {
+	h[i], h[j] = h[j], h[i]
+	h[i].index = i
+	h[j].index = j
+}
+
+func (h *lfuHeap) Push(x interface{}) {
+	e := x.(*lfuEntry)
+	e.index = len(*h)
+	*h = append(*h, e)
+}
+
+func (h *lfuHeap) Pop() interface{} {
+	old := *h
+	n := len(old)
+	e := old[n-1]
+	old[n-1] = nil
+	*h = old[:n-1]
+	return e
+}
+
+type lfuPolicy struct {
+	entries map[string]*lfuEntry
+	heap    lfuHeap
+	tick    uint64
+}
+
+func newLFU() *lfuPolicy {
+	return &lfuPolicy{entries: make(map[string]*lfuEntry)}
+}
+
+func (p *lfuPolicy) add(k string) {
+	if _, ok := p.entries[k]; ok {
+		p.access(k)
+		return
+	}
+	p.tick++
+	e := &lfuEntry{key: k, freq: 1, tick: p.tick}
+	p.entries[k] = e
+	heap.Push(&p.heap, e)
+}
+
+func (p *lfuPolicy) access(k string) {
+	e, ok := p.entries[k]
+	if !ok {
+		return
+	}
+	p.tick++
+	e.freq++
+	e.tick = p.tick
+	heap.Fix(&p.heap, e.index)
+}
+
+func (p *lfuPolicy) remove(k string) {
+	e, ok := p.entries[k]
+	if !ok {
+		return
+	}
+	heap.Remove(&p.heap, e.index)
+	delete(p.entries, k)
+}
+
+func (p *lfuPolicy) victim() (string, bool) {
+	if len(p.heap) == 0 {
+		return "", false
+	}
+	e := heap.Pop(&p.heap).(*lfuEntry)
+	delete(p.entries, e.key)
+	return e.key, true
+}
+
+func (p *lfuPolicy) reset() {
+	p.entries = make(map[string]*lfuEntry)
+	p.heap = nil
+}
@@ -0,0 +1,107 @@
+package cache
+
+import "container/list"
+
+// keyList is a recency ordered list of keys with O(1) lookup
+type keyList struct {
+	l     *list.List
+	items map[string]*list.Element
+}
+
+func newKeyList() *keyList {
+	return &keyList{
+		l:     list.New(),
+		items: make(map[string]*list.Element),
+	}
+}
+
+func (kl *keyList) pushFront(k string) {
+	if e, ok := kl.items[k]; ok {
+		kl.l.MoveToFront(e)
+		return
+	}
+	kl.items[k] = kl.l.PushFront(k)
+}
+
+func (kl *keyList) moveToFront(k string) bool {
+	e, ok := kl.items[k]
+	if ok {
+		kl.l.MoveToFront(e)
+	}
+	return ok
+}
+
+func (kl *keyList) has(k string) bool {
+	_, ok := kl.items[k]
+	return ok
+}
+
+func (kl *keyList) remove(k string) bool {
+	e, ok := kl.items[k]
+	if ok {
+		kl.l.Remove(e)
+		delete(kl.items, k)
+	}
+	return ok
+}
+
+func (kl *keyList) front() (string, bool) {
+	e := kl.l.Front()
+	if e == nil {
+		return "", false
+	}
+	return e.Value.(string), true
+}
+
+func (kl *keyList) back() (string, bool) {
+	e := kl.l.Back()
+	if e == nil {
+		return "", false
+	}
+	return e.Value.(string), true
+}
+
+func (kl *keyList) popBack() (string, bool) {
+	k, ok := kl.back()
+	if ok {
+		kl.remove(k)
+	}
+	return k, ok
+}
+
+func (kl *keyList) len() int {
+	return kl.l.Len()
+}
+
+func (kl *keyList) reset() {
+	kl.l.Init()
+	kl.items = make(map[string]*list.Element)
+}
+
+type lruPolicy struct {
+	keys *keyList
+}
+
+func newLRU() *lruPolicy {
+	return &lruPolicy{keys: newKeyList()}
+}
+
+func (p *lruPolicy) add(k string) {
+	p.keys.pushFront(k)
+}
+
+func (p *lruPolicy) access(k string) {
+	p.keys.moveToFront(k)
+}
+
+func (p *lruPolicy) remove(k string) {
+	p.keys.remove(k)
+}
+
+func (p *lruPolicy) victim() (string, bool) {
+	return p.keys.popBack()
+}
+
+func (p *lruPolicy) reset() {
+	p.keys.reset()
+}
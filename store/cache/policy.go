@@ -0,0 +1,45 @@
+package cache
+
+// EvictionPolicy selects which items are evicted when a bounded cache overflows
+type EvictionPolicy int
+
+const (
+	// LRU evicts the least recently used item
+	LRU EvictionPolicy = iota
+	// LFU evicts the least frequently used item, ties are broken by recency
+	LFU
+	// ARC balances recency and frequency adaptively (Adaptive Replacement Cache)
+	ARC
+	// WTinyLFU admits new items through a small LRU window and a frequency sketch (Window TinyLFU)
+	WTinyLFU
+)
+
+// policy tracks the keys held by the cache and designates eviction victims.
+// Implementations are not safe for concurrent use and rely on the cache lock
+type policy interface {
+	// add records a newly inserted key
+	add(k string)
+	// access records a hit on an existing key
+	access(k string)
+	// remove forgets a key removed from the cache
+	remove(k string)
+	// victim selects and forgets the next key to evict
+	victim() (string, bool)
+	// reset forgets all the keys
+	reset()
+}
+
+func newPolicy(p EvictionPolicy) policy {
+	switch p {
+	case LFU:
+		return newLFU()
+	case ARC:
+		return newARC()
+	case WTinyLFU:
+		return newTinyLFU()
+	case LRU:
+		fallthrough
+	default:
+		return newLRU()
+	}
+}
@@ -0,0 +1,68 @@
+package cache
+
+import (
+	"errors"
+	"fmt"
+)
+
+// ErrValueType is returned by the typed scans meeting a value of another type
+var ErrValueType = errors.New("unexpected value type")
+
+// ScanValues - calls f on a snapshot of the unexpired items, so that writers aren't blocked
+// while scanning, until f returns an error which is then returned
+func (c *cacheMemory) ScanValues(f func(k string, v interface{}) error) error {
+	return scanItems(c.CloneItems(), f)
+}
+
+// Scan - calls f on a snapshot of the unexpired items, failing with ErrValueType on
+// values other than []byte
+func (c *cacheMemory) Scan(f func(k, v []byte) error) error {
+	return c.ScanValues(bytesScanner(f))
+}
+
+// ScanValues - calls f on a snapshot of the unexpired items, so that writers aren't blocked
+// while scanning, until f returns an error which is then returned
+func (sc *shardedCache) ScanValues(f func(k string, v interface{}) error) error {
+	return scanItems(sc.CloneItems(), f)
+}
+
+// Scan - calls f on a snapshot of the unexpired items, failing with ErrValueType on
+// values other than []byte
+func (sc *shardedCache) Scan(f func(k, v []byte) error) error {
+	return sc.ScanValues(bytesScanner(f))
+}
+
+// ScanAs - calls f on a snapshot of the unexpired items of c, failing with ErrValueType on
+// values other than T
+func ScanAs[T any](c Cache, f func(k string, v T) error) error {
+	return c.ScanValues(func(k string, v interface{}) error {
+		t, ok := v.(T)
+		if !ok {
+			return valueTypeError(k, v)
+		}
+		return f(k, t)
+	})
+}
+
+func scanItems(items map[string]Item, f func(string, interface{}) error) error {
+	for k, item := range items {
+		if err := f(k, item.Object); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func bytesScanner(f func(k, v []byte) error) func(string, interface{}) error {
+	return func(k string, v interface{}) error {
+		b, ok := v.([]byte)
+		if !ok {
+			return valueTypeError(k, v)
+		}
+		return f([]byte(k), b)
+	}
+}
+
+func valueTypeError(k string, v interface{}) error {
+	return fmt.Errorf("%w: %T for key %q", ErrValueType, v, k)
+}
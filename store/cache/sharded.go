@@ -0,0 +1,237 @@
+package cache
+
+import (
+	"math"
+	"math/bits"
+	"runtime"
+	"time"
+)
+
+// ShardedCache - a memory cache partitioning the keys across independent shards, each with
+// its own lock, share of the bounds and eviction policy, so that concurrent operations on
+// different keys rarely contend
+type ShardedCache struct {
+	*shardedCache
+}
+
+type shardedCache struct {
+	shards  []*cacheMemory
+	mask    uint64
+	janitor *janitor
+}
+
+// NewSharded creates a sharded memory cache. The bounds of the options are split across the
+// shards without rounding them up, so the cache never holds more than MaxItems items or
+// MaxBytes bytes; the shard count is lowered to fit the bounds, so that each shard holds at
+// least one item and byte. As the keys are hashed, a shard may evict while others have room
+func NewSharded(options Options) *ShardedCache {
+	n := shardCount(options.Shards)
+	if options.MaxItems > 0 {
+		n = min(n, floorPow2(int64(options.MaxItems)))
+	}
+	if options.MaxBytes > 0 {
+		n = min(n, floorPow2(options.MaxBytes))
+	}
+	sc := &shardedCache{
+		shards: make([]*cacheMemory, n),
+		mask:   uint64(n - 1),
+	}
+	for i := range sc.shards {
+		shardOptions := options
+		shardOptions.MaxItems = int(split(int64(options.MaxItems), n, i))
+		shardOptions.MaxBytes = split(options.MaxBytes, n, i)
+		sc.shards[i] = newCacheWithOptions(shardOptions)
+	}
+	w := &ShardedCache{shardedCache: sc}
+	if options.CleanupInterval > 0 {
+		sc.janitor = &janitor{
+			Interval: options.CleanupInterval,
+			stop:     make(chan struct{}),
+		}
+		go sc.janitor.Run(sc)
+		runtime.SetFinalizer(w, func(w *ShardedCache) {
+			w.janitor.stop <- struct{}{}
+		})
+	}
+	return w
+}
+
+// shardCount rounds n up to a power of two, defaulting to four shards per CPU
+func shardCount(n int) int {
+	if n <= 0 {
+		n = 4 * runtime.GOMAXPROCS(0)
+	}
+	if n == 1 {
+		return 1
+	}
+	return 1 << bits.Len(uint(n-1))
+}
+
+// floorPow2 rounds n > 0 down to a power of two, capped at the largest int
+func floorPow2(n int64) int {
+	return 1 << min(bits.Len64(uint64(n))-1, bits.UintSize-2)
+}
+
+// split returns the share of the bound of the i-th of n shards, spreading the remainder over
+// the first shards
+func split(bound int64, n, i int) int64 {
+	share := bound / int64(n)
+	if int64(i) < bound%int64(n) {
+		share++
+	}
+	return share
+}
+
+// shard routes a key with the FNV-1a hash
+func (sc *shardedCache) shard(k string) *cacheMemory {
+	h := uint64(14695981039346656037)
+	for i := 0; i < len(k); i++ {
+		h ^= uint64(k[i])
+		h *= 1099511628211
+	}
+	return sc.shards[h&sc.mask]
+}
+
+// Shards - returns the number of shards
+func (sc *shardedCache) Shards() int {
+	return len(sc.shards)
+}
+
+func (sc *shardedCache) SetWithExpiration(k string, x interface{}, d time.Duration) {
+	sc.shard(k).SetWithExpiration(k, x, d)
+}
+
+func (sc *shardedCache) Set(k string, x interface{}) {
+	sc.shard(k).Set(k, x)
+}
+
+func (sc *shardedCache) Get(k string) (interface{}, bool) {
+	return sc.shard(k).Get(k)
+}
+
+// GetWithExpiration returns an item and its expiration time, which is the zero time
+// if the item never expires
+func (sc *shardedCache) GetWithExpiration(k string) (interface{}, time.Time, bool) {
+	return sc.shard(k).GetWithExpiration(k)
+}
+
+// Peek returns an unexpired item and its expiration time without counting the lookup
+func (sc *shardedCache) Peek(k string) (interface{}, time.Time, bool) {
+	return sc.shard(k).Peek(k)
+}
+
+func (sc *shardedCache) Delete(k string) {
+	sc.shard(k).Delete(k)
+}
+
+// Delete all expired items from the cache.
+func (sc *shardedCache) DeleteExpired() {
+	for _, c := range sc.shards {
+		c.DeleteExpired()
+	}
+}
+
+func (sc *shardedCache) OnEvicted(f func(string, interface{})) {
+	for _, c := range sc.shards {
+		c.OnEvicted(f)
+	}
+}
+
+// Subscribe - registers a handler notified of every item leaving the cache along with
+// the reason, and returns a function unregistering it
+func (sc *shardedCache) Subscribe(h EvictionHandler) func() {
+	unsubscribes := make([]func(), len(sc.shards))
+	for i, c := range sc.shards {
+		unsubscribes[i] = c.Subscribe(h)
+	}
+	return func() {
+		for _, unsubscribe := range unsubscribes {
+			unsubscribe()
+		}
+	}
+}
+
+func (sc *shardedCache) CloneItems() map[string]Item {
+	m := make(map[string]Item)
+	for _, c := range sc.shards {
+		for k, v := range c.CloneItems() {
+			m[k] = v
+		}
+	}
+	return m
+}
+
+func (sc *shardedCache) ItemCount() int {
+	n := 0
+	for _, c := range sc.shards {
+		n += c.ItemCount()
+	}
+	return n
+}
+
+func (sc *shardedCache) Empty() {
+	for _, c := range sc.shards {
+		c.Empty()
+	}
+}
+
+// Shrink evicts the coldest items of each shard until the cache holds at most target bytes
+// and returns the number of evicted items. The excess bytes are shared out across the shards
+// in proportion to their size, so that uneven shards aren't cut well below target
+func (sc *shardedCache) Shrink(target int64) int {
+	sizes := make([]int64, len(sc.shards))
+	var total int64
+	for i, c := range sc.shards {
+		sizes[i] = c.Bytes()
+		total += sizes[i]
+	}
+	excess := total - target
+	if excess <= 0 {
+		return 0
+	}
+	n := 0
+	for i, c := range sc.shards {
+		if sizes[i] == 0 {
+			continue
+		}
+		// rounding the shares up guarantees that they cover the excess
+		share := int64(math.Ceil(float64(excess) * float64(sizes[i]) / float64(total)))
+		n += c.Shrink(sizes[i] - share)
+	}
+	return n
+}
+
+// Bytes returns the size of the keys and values held by the cache
+func (sc *shardedCache) Bytes() int64 {
+	var n int64
+	for _, c := range sc.shards {
+		n += c.Bytes()
+	}
+	return n
+}
+
+// Counters returns the statistics of the cache without counting the expired items, summed
+// across the shards
+func (sc *shardedCache) Counters() Stats {
+	return sc.sum((*cacheMemory).Counters)
+}
+
+// Stats returns the statistics of the cache, summed across the shards
+func (sc *shardedCache) Stats() Stats {
+	return sc.sum((*cacheMemory).Stats)
+}
+
+func (sc *shardedCache) sum(shardStats func(*cacheMemory) Stats) Stats {
+	var stats Stats
+	for _, c := range sc.shards {
+		s := shardStats(c)
+		stats.Items += s.Items
+		stats.Bytes += s.Bytes
+		stats.Expired += s.Expired
+		stats.Hits += s.Hits
+		stats.Misses += s.Misses
+		stats.Evictions += s.Evictions
+		stats.Expirations += s.Expirations
+	}
+	return stats
+}
@@ -0,0 +1,295 @@
+package cache
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// A snapshot holds the unexpired items of a cache:
+//
+//	magic (2) | version (1) | item count (uvarint) | items | crc32 (4)
+//
+// where each item is
+//
+//	key length (uvarint) | key | kind (1) | value length (uvarint) | value |
+//	expiration (varint) | created (varint) | sliding ttl (varint)
+//
+// Times are in unix nanoseconds, so that deadlines survive a restart. The checksum covers
+// everything before it
+const snapshotVersion = 1
+
+const (
+	kindBytes byte = iota
+	kindString
+)
+
+var (
+	// ErrInvalidSnapshot is returned when loading a truncated or corrupted snapshot
+	ErrInvalidSnapshot = errors.New("invalid cache snapshot")
+	// ErrUnsupportedValue is returned when saving items holding neither []byte nor string values
+	ErrUnsupportedValue = errors.New("unsupported snapshot value")
+
+	snapshotMagic = [2]byte{0xfe, 'c'}
+	crcTable      = crc32.MakeTable(crc32.Castagnoli)
+)
+
+// writeSnapshot encodes items to w
+func writeSnapshot(w io.Writer, items map[string]Item) error {
+	bw := bufio.NewWriter(w)
+	crc := crc32.New(crcTable)
+	out := io.MultiWriter(bw, crc)
+
+	buf := make([]byte, 0, 3*binary.MaxVarintLen64)
+	buf = append(buf, snapshotMagic[:]...)
+	buf = append(buf, snapshotVersion)
+	buf = binary.AppendUvarint(buf, uint64(len(items)))
+	if _, err := out.Write(buf); err != nil {
+		return err
+	}
+	for k, item := range items {
+		var (
+			kind  byte
+			value []byte
+		)
+		switch v := item.Object.(type) {
+		case []byte:
+			kind, value = kindBytes, v
+		case string:
+			kind, value = kindString, []byte(v)
+		default:
+			return fmt.Errorf("%w: %T for key %q", ErrUnsupportedValue, item.Object, k)
+		}
+		buf = binary.AppendUvarint(buf[:0], uint64(len(k)))
+		buf = append(buf, k...)
+		buf = append(buf, kind)
+		buf = binary.AppendUvarint(buf, uint64(len(value)))
+		buf = append(buf, value...)
+		buf = binary.AppendVarint(buf, item.Expiration)
+		buf = binary.AppendVarint(buf, item.Created)
+		buf = binary.AppendVarint(buf, int64(item.TTL))
+		if _, err := out.Write(buf); err != nil {
+			return err
+		}
+	}
+	if err := binary.Write(bw, binary.BigEndian, crc.Sum32()); err != nil {
+		return err
+	}
+	return bw.Flush()
+}
+
+// snapshotEntry - represents an item read from a snapshot
+type snapshotEntry struct {
+	k    string
+	item Item
+}
+
+// readSnapshot decodes the unexpired items of a snapshot
+func readSnapshot(r io.Reader) ([]snapshotEntry, error) {
+	in := &snapshotReader{br: bufio.NewReader(r)}
+
+	header := make([]byte, 3)
+	if _, err := io.ReadFull(in, header); err != nil {
+		return nil, snapshotError(err)
+	}
+	if header[0] != snapshotMagic[0] || header[1] != snapshotMagic[1] {
+		return nil, fmt.Errorf("%w: bad magic", ErrInvalidSnapshot)
+	}
+	if header[2] != snapshotVersion {
+		return nil, fmt.Errorf("%w: unknown version %d", ErrInvalidSnapshot, header[2])
+	}
+	count, err := binary.ReadUvarint(in)
+	if err != nil {
+		return nil, snapshotError(err)
+	}
+
+	var entries []snapshotEntry
+	now := time.Now().UnixNano()
+	for i := uint64(0); i < count; i++ {
+		k, err := in.readBytes()
+		if err != nil {
+			return nil, snapshotError(err)
+		}
+		kind, err := in.ReadByte()
+		if err != nil {
+			return nil, snapshotError(err)
+		}
+		value, err := in.readBytes()
+		if err != nil {
+			return nil, snapshotError(err)
+		}
+		var item Item
+		switch kind {
+		case kindBytes:
+			item.Object = value
+		case kindString:
+			item.Object = string(value)
+		default:
+			return nil, fmt.Errorf("%w: unknown value kind %d", ErrInvalidSnapshot, kind)
+		}
+		var ttl int64
+		for _, field := range []*int64{&item.Expiration, &item.Created, &ttl} {
+			if *field, err = binary.ReadVarint(in); err != nil {
+				return nil, snapshotError(err)
+			}
+		}
+		item.TTL = time.Duration(ttl)
+		if item.Expiration > 0 && now > item.Expiration {
+			continue
+		}
+		entries = append(entries, snapshotEntry{string(k), item})
+	}
+
+	sum := in.sum
+	var expected uint32
+	if err := binary.Read(in.br, binary.BigEndian, &expected); err != nil {
+		return nil, snapshotError(err)
+	}
+	if sum != expected {
+		return nil, fmt.Errorf("%w: checksum mismatch", ErrInvalidSnapshot)
+	}
+	return entries, nil
+}
+
+func snapshotError(err error) error {
+	if errors.Is(err, io.EOF) || errors.Is(err, io.ErrUnexpectedEOF) {
+		return fmt.Errorf("%w: truncated", ErrInvalidSnapshot)
+	}
+	return fmt.Errorf("%w: %w", ErrInvalidSnapshot, err)
+}
+
+// snapshotReader reads the fields of a snapshot, checksumming them
+type snapshotReader struct {
+	br  *bufio.Reader
+	sum uint32
+}
+
+func (sr *snapshotReader) Read(p []byte) (int, error) {
+	n, err := sr.br.Read(p)
+	sr.sum = crc32.Update(sr.sum, crcTable, p[:n])
+	return n, err
+}
+
+func (sr *snapshotReader) ReadByte() (byte, error) {
+	b, err := sr.br.ReadByte()
+	if err == nil {
+		sr.sum = crc32.Update(sr.sum, crcTable, []byte{b})
+	}
+	return b, err
+}
+
+// readBytes reads a length prefixed field, growing the buffer as data arrives so that a
+// corrupted length can't allocate unbounded memory
+func (sr *snapshotReader) readBytes() ([]byte, error) {
+	n, err := binary.ReadUvarint(sr)
+	if err != nil {
+		return nil, err
+	}
+	var buf bytes.Buffer
+	if _, err := io.CopyN(&buf, sr, int64(n)); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// saveFile writes a snapshot to path through a temporary file, so that an existing
+// snapshot is replaced atomically
+func saveFile(path string, save func(io.Writer) error) error {
+	f, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+".tmp*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(f.Name())
+	if err := save(f); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+	return os.Rename(f.Name(), path)
+}
+
+func loadFile(path string, load func(io.Reader) error) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	return load(f)
+}
+
+// Save - writes the unexpired items holding []byte or string values to w, keeping their
+// deadlines. It fails with ErrUnsupportedValue on other values
+func (c *cacheMemory) Save(w io.Writer) error {
+	return writeSnapshot(w, c.CloneItems())
+}
+
+// Load - adds the unexpired items of a snapshot written by Save to the cache, replacing
+// the existing ones with the same key. Nothing is added if the snapshot is invalid
+func (c *cacheMemory) Load(r io.Reader) error {
+	entries, err := readSnapshot(r)
+	if err != nil {
+		return err
+	}
+	var evictedItems []keyAndValue
+	c.mu.Lock()
+	for _, e := range entries {
+		evictedItems = append(evictedItems, c.put(e.k, e.item)...)
+	}
+	l := c.listeners
+	c.mu.Unlock()
+	l.notify(evictedItems)
+	return nil
+}
+
+// SaveFile - writes a snapshot of the cache to path
+func (c *cacheMemory) SaveFile(path string) error {
+	return saveFile(path, c.Save)
+}
+
+// LoadFile - adds the items of the snapshot at path to the cache
+func (c *cacheMemory) LoadFile(path string) error {
+	return loadFile(path, c.Load)
+}
+
+// Save - writes the unexpired items holding []byte or string values to w, keeping their
+// deadlines. It fails with ErrUnsupportedValue on other values
+func (sc *shardedCache) Save(w io.Writer) error {
+	return writeSnapshot(w, sc.CloneItems())
+}
+
+// Load - adds the unexpired items of a snapshot written by Save to the cache, replacing
+// the existing ones with the same key. Nothing is added if the snapshot is invalid
+func (sc *shardedCache) Load(r io.Reader) error {
+	entries, err := readSnapshot(r)
+	if err != nil {
+		return err
+	}
+	for _, e := range entries {
+		c := sc.shard(e.k)
+		c.mu.Lock()
+		evictedItems := c.put(e.k, e.item)
+		l := c.listeners
+		c.mu.Unlock()
+		l.notify(evictedItems)
+	}
+	return nil
+}
+
+// SaveFile - writes a snapshot of the cache to path
+func (sc *shardedCache) SaveFile(path string) error {
+	return saveFile(path, sc.Save)
+}
+
+// LoadFile - adds the items of the snapshot at path to the cache
+func (sc *shardedCache) LoadFile(path string) error {
+	return loadFile(path, sc.Load)
+}
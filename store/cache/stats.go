@@ -0,0 +1,61 @@
+package cache
+
+import (
+	"sync/atomic"
+	"time"
+)
+
+// Stats - represents the statistics of a cache
+type Stats struct {
+	// Items is the number of items held, including the expired ones not deleted yet
+	Items int
+	// Bytes is the size of the keys and values held
+	Bytes int64
+	// Expired is the number of items held past their expiration
+	Expired int
+	// Hits and Misses count the lookups
+	Hits   uint64
+	Misses uint64
+	// Evictions counts the items removed to fit the bounds or by Shrink
+	Evictions uint64
+	// Expirations counts the expired items deleted
+	Expirations uint64
+}
+
+type counters struct {
+	hits        atomic.Uint64
+	misses      atomic.Uint64
+	evictions   atomic.Uint64
+	expirations atomic.Uint64
+}
+
+// Counters returns the statistics of the cache without counting the expired items, which
+// requires a pass over the items
+func (c *cacheMemory) Counters() Stats {
+	c.mu.RLock()
+	stats := Stats{
+		Items: len(c.Items),
+		Bytes: c.bytes,
+	}
+	c.mu.RUnlock()
+
+	stats.Hits = c.counters.hits.Load()
+	stats.Misses = c.counters.misses.Load()
+	stats.Evictions = c.counters.evictions.Load()
+	stats.Expirations = c.counters.expirations.Load()
+	return stats
+}
+
+// Stats returns the statistics of the cache
+func (c *cacheMemory) Stats() Stats {
+	stats := c.Counters()
+	now := time.Now().UnixNano()
+	c.mu.RLock()
+	for _, item := range c.Items {
+		if item.Expiration > 0 && now > item.Expiration {
+			stats.Expired++
+		}
+	}
+	c.mu.RUnlock()
+	return stats
+}
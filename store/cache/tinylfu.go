@@ -0,0 +1,177 @@
+package cache
+
+import "hash/fnv"
+
+const (
+	sketchDepth    = 4
+	sketchMinWidth = 1024
+	sketchMaxCount = 15
+)
+
+// countMinSketch estimates access frequencies with saturating counters that are
+// periodically halved so that old popularity fades away
+type countMinSketch struct {
+	rows      [sketchDepth][]uint8
+	mask      uint64
+	additions int
+}
+
+func newCountMinSketch(width int) *countMinSketch {
+	w := sketchMinWidth
+	for w < width {
+		w <<= 1
+	}
+	s := &countMinSketch{mask: uint64(w - 1)}
+	for i := range s.rows {
+		s.rows[i] = make([]uint8, w)
+	}
+	return s
+}
+
+// grow returns a sketch at least width wide carrying over the counters: as the widths are
+// powers of two, the low bits of a key's new indexes are its old ones
+func (s *countMinSketch) grow(width int) *countMinSketch {
+	g := newCountMinSketch(width)
+	for i := range g.rows {
+		for j := range g.rows[i] {
+			g.rows[i][j] = s.rows[i][uint64(j)&s.mask]
+		}
+	}
+	g.additions = s.additions
+	return g
+}
+
+func (s *countMinSketch) width() int {
+	return int(s.mask + 1)
+}
+
+func (s *countMinSketch) indexes(k string) [sketchDepth]uint64 {
+	h := fnv.New64a()
+	_, _ = h.Write([]byte(k))
+	sum := h.Sum64()
+	h1, h2 := sum, (sum>>32)|1
+	var idx [sketchDepth]uint64
+	for i := range idx {
+		idx[i] = (h1 + uint64(i)*h2) & s.mask
+	}
+	return idx
+}
+
+func (s *countMinSketch) increment(k string) {
+	for i, idx := range s.indexes(k) {
+		if s.rows[i][idx] < sketchMaxCount {
+			s.rows[i][idx]++
+		}
+	}
+	s.additions++
+	if s.additions >= 10*s.width() {
+		s.age()
+	}
+}
+
+func (s *countMinSketch) estimate(k string) uint8 {
+	est := uint8(sketchMaxCount)
+	for i, idx := range s.indexes(k) {
+		est = min(est, s.rows[i][idx])
+	}
+	return est
+}
+
+func (s *countMinSketch) age() {
+	for i := range s.rows {
+		for j := range s.rows[i] {
+			s.rows[i][j] >>= 1
+		}
+	}
+	s.additions = 0
+}
+
+// tinyLFUPolicy implements Window TinyLFU: new keys enter a small LRU window (1% of the
+// resident keys) and then move to a segmented LRU main area (probation and protected,
+// 80% of the main area). On eviction the newest key of probation competes with its
+// least recent one and the less frequent of the two, according to the sketch, is evicted
+type tinyLFUPolicy struct {
+	window    *keyList
+	probation *keyList
+	protected *keyList
+	sketch    *countMinSketch
+}
+
+func newTinyLFU() *tinyLFUPolicy {
+	return &tinyLFUPolicy{
+		window:    newKeyList(),
+		probation: newKeyList(),
+		protected: newKeyList(),
+		sketch:    newCountMinSketch(sketchMinWidth),
+	}
+}
+
+func (p *tinyLFUPolicy) len() int {
+	return p.window.len() + p.probation.len() + p.protected.len()
+}
+
+func (p *tinyLFUPolicy) add(k string) {
+	if p.window.has(k) || p.probation.has(k) || p.protected.has(k) {
+		p.access(k)
+		return
+	}
+	p.sketch.increment(k)
+	p.window.pushFront(k)
+	// grow the sketch with the number of resident keys, keeping the frequency history
+	if n := p.len(); n > p.sketch.width() {
+		p.sketch = p.sketch.grow(2 * n)
+	}
+	// overflowing window keys move to probation, where they compete on eviction
+	for windowCap := max(p.len()/100, 1); p.window.len() > windowCap; {
+		wk, _ := p.window.popBack()
+		p.probation.pushFront(wk)
+	}
+}
+
+func (p *tinyLFUPolicy) access(k string) {
+	p.sketch.increment(k)
+	switch {
+	case p.window.moveToFront(k):
+	case p.protected.moveToFront(k):
+	case p.probation.remove(k):
+		p.protected.pushFront(k)
+		protectedCap := max((p.probation.len()+p.protected.len())*8/10, 1)
+		for p.protected.len() > protectedCap {
+			dk, _ := p.protected.popBack()
+			p.probation.pushFront(dk)
+		}
+	}
+}
+
+func (p *tinyLFUPolicy) remove(k string) {
+	if !p.window.remove(k) && !p.probation.remove(k) {
+		p.protected.remove(k)
+	}
+}
+
+func (p *tinyLFUPolicy) victim() (string, bool) {
+	candidate, hasCandidate := p.probation.front()
+	victim, hasVictim := p.probation.back()
+	switch {
+	case hasCandidate && hasVictim && candidate != victim:
+		if p.sketch.estimate(candidate) > p.sketch.estimate(victim) {
+			p.probation.remove(victim)
+			return victim, true
+		}
+		p.probation.remove(candidate)
+		return candidate, true
+	case hasVictim:
+		return p.probation.popBack()
+	case p.protected.len() > 0:
+		return p.protected.popBack()
+	default:
+		return p.window.popBack()
+	}
+}
+
+func (p *tinyLFUPolicy) reset() {
+	p.window.reset()
+	p.probation.reset()
+	p.protected.reset()
+	p.sketch = newCountMinSketch(sketchMinWidth)
+}
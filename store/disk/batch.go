@@ -0,0 +1,117 @@
+package disk
+
+import (
+	"strconv"
+	"time"
+)
+
+// BatchOpType - represents the kind of a batch operation
+type BatchOpType int
+
+const (
+	BatchPut BatchOpType = iota
+	BatchDelete
+	BatchIncr
+)
+
+// BatchOp - represents a single operation of a batch
+type BatchOp struct {
+	Type  BatchOpType
+	Key   string
+	Value []byte
+	TTL   time.Duration
+	By    int64
+}
+
+// Batch - collects operations committed together with DB.WriteBatch. LevelDB, BBolt and BuntDB
+// commit a batch atomically, while PogrebDB, lacking transactions, applies it under the db lock
+// (isolating it from other batches and atomic updates) and restores the previous values if a
+// write fails, without guarantees in case of crash
+type Batch struct {
+	ops []BatchOp
+}
+
+// NewBatch creates an empty batch
+func NewBatch() *Batch {
+	return &Batch{}
+}
+
+// Put - sets a key with the specified value and optional ttl
+func (b *Batch) Put(k string, v []byte, ttl time.Duration) {
+	b.ops = append(b.ops, BatchOp{Type: BatchPut, Key: k, Value: v, TTL: ttl})
+}
+
+// Delete - removes a key
+func (b *Batch) Delete(k string) {
+	b.ops = append(b.ops, BatchOp{Type: BatchDelete, Key: k})
+}
+
+// Incr - increments the key by the specified value, a missing key counts as zero
+func (b *Batch) Incr(k string, by int64) {
+	b.ops = append(b.ops, BatchOp{Type: BatchIncr, Key: k, By: by})
+}
+
+// Ops - returns the operations of the batch
+func (b *Batch) Ops() []BatchOp {
+	return b.ops
+}
+
+// Len - returns the number of operations
+func (b *Batch) Len() int {
+	return len(b.ops)
+}
+
+// Reset - removes all the operations
+func (b *Batch) Reset() {
+	b.ops = b.ops[:0]
+}
+
+// pendingValue is a value written by a previous operation of a batch, with its ttl
+type pendingValue struct {
+	v   []byte
+	ttl time.Duration
+}
+
+// replay walks the batch resolving increments against the values written by previous
+// operations or, for untouched keys, returned by get along with their remaining ttl (zero if
+// they don't expire), and forwards the resulting writes. Like DB.Incr, increments keep the ttl
+func (b *Batch) replay(get func(k string) ([]byte, time.Duration), put func(k string, v []byte, ttl time.Duration) error, del func(k string) error) error {
+	pending := make(map[string]pendingValue)
+	for _, op := range b.ops {
+		var err error
+		switch op.Type {
+		case BatchPut:
+			pending[op.Key] = pendingValue{v: op.Value, ttl: op.TTL}
+			err = put(op.Key, op.Value, op.TTL)
+		case BatchDelete:
+			pending[op.Key] = pendingValue{}
+			err = del(op.Key)
+		case BatchIncr:
+			current, ok := pending[op.Key]
+			if !ok {
+				current.v, current.ttl = get(op.Key)
+			}
+			n, _ := strconv.ParseInt(string(current.v), 10, 64)
+			current.v = intToByteSlice(n + op.By)
+			pending[op.Key] = current
+			err = put(op.Key, current.v, current.ttl)
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// keys returns the distinct keys touched by the batch
+func (b *Batch) keys() []string {
+	seen := make(map[string]struct{}, len(b.ops))
+	var keys []string
+	for _, op := range b.ops {
+		if _, ok := seen[op.Key]; !ok {
+			seen[op.Key] = struct{}{}
+			keys = append(keys, op.Key)
+		}
+	}
+	return keys
+}
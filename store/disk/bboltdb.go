@@ -2,12 +2,11 @@ package disk
 
 import (
 	"bytes"
-	"strconv"
+	"iter"
+	"net/url"
 	"sync"
 	"time"
 
-	"github.com/pkg/errors"
-
 	bolt "go.etcd.io/bbolt"
 )
 
@@ -16,11 +15,44 @@ type BBoltDB struct {
 	db *bolt.DB
 	sync.RWMutex
 	BucketName string
+	counters   counters
+}
+
+func init() {
+	Register("bbolt", openBoltDBBackend)
 }
 
 // OpenBoltDB - Opens the specified path
 func OpenBoltDBB(path string) (*BBoltDB, error) {
-	db, err := bolt.Open(path, 0600, nil)
+	return openBoltDB(path, nil)
+}
+
+// defaultBucket is the bucket used by dbs opened by name or dsn without a "bucket" param
+const defaultBucket = "hmap"
+
+// openBoltDBBackend opens a bbolt db accepting the "bucket" name and the file lock "timeout" params
+func openBoltDBBackend(path string, params url.Values) (DB, error) {
+	options := &bolt.Options{}
+	if value := params.Get("timeout"); value != "" {
+		timeout, err := time.ParseDuration(value)
+		if err != nil {
+			return nil, err
+		}
+		options.Timeout = timeout
+	}
+	bbdb, err := openBoltDB(path, options)
+	if err != nil {
+		return nil, err
+	}
+	bbdb.BucketName = params.Get("bucket")
+	if bbdb.BucketName == "" {
+		bbdb.BucketName = defaultBucket
+	}
+	return bbdb, nil
+}
+
+func openBoltDB(path string, options *bolt.Options) (*BBoltDB, error) {
+	db, err := bolt.Open(path, 0600, options)
 	if err != nil {
 		return nil, err
 	}
@@ -33,8 +65,12 @@ func OpenBoltDBB(path string) (*BBoltDB, error) {
 
 // Size - returns the size of the database in bytes
 func (b *BBoltDB) Size() int64 {
-	// not implemented
-	return 0
+	var size int64
+	_ = b.db.View(func(tx *bolt.Tx) error {
+		size = tx.Size()
+		return nil
+	})
+	return size
 }
 
 // Close ...
@@ -49,22 +85,34 @@ func (b *BBoltDB) GC() error {
 
 // Incr - increment the key by the specified value
 func (b *BBoltDB) Incr(k string, by int64) (int64, error) {
-	return 0, ErrNotImplemented
+	return incr(b, k, by)
 }
 
-func (b *BBoltDB) set(k, v []byte, ttl time.Duration) error {
+func (b *BBoltDB) modify(k string, f modifyFunc) error {
 	return b.db.Update(func(tx *bolt.Tx) error {
-		var expires int64
-		if ttl > 0 {
-			expires = time.Now().Add(ttl).Unix()
+		bucket, err := tx.CreateBucketIfNotExists([]byte(b.BucketName))
+		if err != nil {
+			return err
 		}
+		old, expires, exists, err := splitRecord(bucket.Get([]byte(k)))
+		if err != nil {
+			return err
+		}
+		v, ttl, err := f(old, exists, remainingTTL(expires))
+		if err != nil {
+			return err
+		}
+		return bucket.Put([]byte(k), encodeRecord(v, ttl))
+	})
+}
+
+func (b *BBoltDB) set(k, v []byte, ttl time.Duration) error {
+	return b.db.Update(func(tx *bolt.Tx) error {
 		b, err := tx.CreateBucketIfNotExists([]byte(b.BucketName))
 		if err != nil {
 			return err
 		}
-		expiresBytes := append(intToByteSlice(expires), expSeparator[:]...)
-		v = append(expiresBytes, v...)
-		return b.Put(k, v)
+		return b.Put(k, encodeRecord(v, ttl))
 	})
 }
 
@@ -75,47 +123,94 @@ func (b *BBoltDB) Set(k string, v []byte, ttl time.Duration) error {
 
 // MSet - sets multiple key-value pairs
 func (b *BBoltDB) MSet(data map[string][]byte) error {
-	return ErrNotImplemented
+	batch := NewBatch()
+	for k, v := range data {
+		batch.Put(k, v, 0)
+	}
+	return b.WriteBatch(batch)
+}
+
+// WriteBatch - commits the batch atomically within a single transaction
+func (b *BBoltDB) WriteBatch(batch *Batch) error {
+	return b.db.Update(func(tx *bolt.Tx) error {
+		bucket, err := tx.CreateBucketIfNotExists([]byte(b.BucketName))
+		if err != nil {
+			return err
+		}
+		return batch.replay(
+			func(k string) ([]byte, time.Duration) {
+				v, expires, ok, err := splitRecord(bucket.Get([]byte(k)))
+				if !ok || err != nil {
+					return nil, 0
+				}
+				return v, remainingTTL(expires)
+			},
+			func(k string, v []byte, ttl time.Duration) error {
+				return bucket.Put([]byte(k), encodeRecord(v, ttl))
+			},
+			func(k string) error {
+				return bucket.Delete([]byte(k))
+			},
+		)
+	})
 }
 
-func (b *BBoltDB) get(k string) ([]byte, error) {
-	var data []byte
-	delete := false
+func (b *BBoltDB) get(k string) ([]byte, int64, error) {
+	var (
+		data    []byte
+		expires int64
+	)
+	expired := false
 
-	return data, b.db.Update(func(tx *bolt.Tx) error {
+	err := b.db.Update(func(tx *bolt.Tx) error {
 		b, err := tx.CreateBucketIfNotExists([]byte(b.BucketName))
 		if err != nil {
 			return err
 		}
-		data = b.Get([]byte(k))
-		if data == nil {
+		item := b.Get([]byte(k))
+		if item == nil {
 			return ErrNoData
 		}
-		parts := bytes.SplitN(data, []byte(expSeparator), 2)
-		expires, actual := parts[0], parts[1]
-		if exp, _ := strconv.Atoi(string(expires)); exp > 0 && int(time.Now().Unix()) >= exp {
-			delete = true
+		actual, e, err := decodeRecord(item)
+		if err != nil {
+			return err
 		}
-		data = actual
-
-		if delete {
+		expires = e
+		if isExpired(e) {
+			expired = true
 			return b.Delete([]byte(k))
 		}
+		// the value is only valid within the transaction
+		data = bytes.Clone(actual)
 
 		return nil
 	})
+	if err == nil && expired {
+		err = ErrNotFound
+	}
+	return data, expires, err
 }
 
 // Get - fetches the value of the specified k
 func (b *BBoltDB) Get(k string) ([]byte, error) {
-	return b.get(k)
+	v, _, err := b.get(k)
+	b.counters.lookup(err)
+	return v, err
+}
+
+// GetWithExpiration - fetches the value of the specified k and its expiration time, which is
+// the zero time if it doesn't expire
+func (b *BBoltDB) GetWithExpiration(k string) ([]byte, time.Time, error) {
+	v, expires, err := b.get(k)
+	b.counters.lookup(err)
+	return v, expirationTime(expires), err
 }
 
 // MGet - fetch multiple values of the specified keys
 func (b *BBoltDB) MGet(keys []string) [][]byte {
 	var data [][]byte
 	for _, key := range keys {
-		val, err := b.get(key)
+		val, _, err := b.get(key)
 		if err != nil {
 			data = append(data, []byte{})
 			continue
@@ -127,28 +222,23 @@ func (b *BBoltDB) MGet(keys []string) [][]byte {
 
 // TTL - returns the time to live of the specified key's value
 func (b *BBoltDB) TTL(key string) int64 {
-	item, err := b.get(key)
-	if err != nil {
-		return -2
-	}
-
-	parts := bytes.SplitN(item, []byte(expSeparator), 2)
-	exp, _ := strconv.Atoi(string(parts[0]))
-	if exp == 0 {
-		return -1
-	}
-
-	now := time.Now().Unix()
-	if now >= int64(exp) {
-		return -2
-	}
-
-	return int64(exp) - now
+	var item []byte
+	_ = b.db.View(func(tx *bolt.Tx) error {
+		if bucket := tx.Bucket([]byte(b.BucketName)); bucket != nil {
+			item = bytes.Clone(bucket.Get([]byte(key)))
+		}
+		return nil
+	})
+	return recordTTL(item)
 }
 
 // MDel - removes key(s) from the store
 func (b *BBoltDB) MDel(keys []string) error {
-	return ErrNotImplemented
+	batch := NewBatch()
+	for _, k := range keys {
+		batch.Delete(k)
+	}
+	return b.WriteBatch(batch)
 }
 
 // Del - removes key from the store
@@ -178,19 +268,204 @@ func (b *BBoltDB) Scan(scannerOpt ScannerOptions) error {
 	return b.db.View(func(tx *bolt.Tx) error {
 		b := tx.Bucket([]byte(b.BucketName))
 		if b == nil {
-			return errors.New("bucket not found")
+			// nothing has been written yet
+			return nil
 		}
 		c := b.Cursor()
-		for key, val := c.First(); key != nil; key, val = c.Next() {
-			parts := bytes.SplitN(val, []byte(expSeparator), 2)
-			data := val
-			if len(parts) == 2 {
-				data = parts[1]
+		key, val := c.First()
+		if start := scanStart(scannerOpt); start != "" {
+			key, val = c.Seek([]byte(start))
+		}
+		for ; key != nil; key, val = c.Next() {
+			if skipOffset(scannerOpt, key) {
+				continue
+			}
+			if !valid(key) {
+				break
 			}
-			if !valid(key) || scannerOpt.Handler(key, data) != nil {
+			data, expires, err := decodeRecord(val)
+			if err != nil {
+				return err
+			}
+			if isExpired(expires) {
+				continue
+			}
+			if scannerOpt.Handler(key, data) != nil {
 				break
 			}
 		}
 		return nil
 	})
 }
+
+// All - returns an iterator over all the items. The iteration runs within a read transaction,
+// so writing to the same db from the loop body may deadlock
+func (b *BBoltDB) All() iter.Seq2[[]byte, []byte] {
+	return b.Prefix("")
+}
+
+// Keys - returns an iterator over all the keys
+func (b *BBoltDB) Keys() iter.Seq[[]byte] {
+	return keysOf(b.All())
+}
+
+// Prefix - returns an iterator over the items whose key starts with p
+func (b *BBoltDB) Prefix(p string) iter.Seq2[[]byte, []byte] {
+	return func(yield func([]byte, []byte) bool) {
+		_ = b.db.View(func(tx *bolt.Tx) error {
+			bucket := tx.Bucket([]byte(b.BucketName))
+			if bucket == nil {
+				return nil
+			}
+			c := bucket.Cursor()
+			for key, val := c.Seek([]byte(p)); key != nil && bytes.HasPrefix(key, []byte(p)); key, val = c.Next() {
+				data, expires, err := decodeRecord(val)
+				// corrupted records are surfaced by Get and Scan
+				if err != nil || isExpired(expires) {
+					continue
+				}
+				if !yield(key, data) {
+					return nil
+				}
+			}
+			return nil
+		})
+	}
+}
+
+// Update - atomically replaces the value of k with the one computed by f, preserving its ttl.
+// f can return ErrAbortUpdate to leave the key untouched
+func (b *BBoltDB) Update(k string, f func(old []byte, exists bool) ([]byte, error)) error {
+	return update(b, k, f)
+}
+
+// CompareAndSwap - atomically sets k to new if its current value is old
+func (b *BBoltDB) CompareAndSwap(k string, old, new []byte) (bool, error) {
+	return compareAndSwap(b, k, old, new)
+}
+
+// SetNX - atomically sets k if it doesn't exist
+func (b *BBoltDB) SetNX(k string, v []byte, ttl time.Duration) (bool, error) {
+	return setNX(b, k, v, ttl)
+}
+
+// GetSet - atomically sets k without expiration and returns its previous value, nil if it didn't exist
+func (b *BBoltDB) GetSet(k string, v []byte) ([]byte, error) {
+	return getSet(b, k, v)
+}
+
+// SetTTL - atomically sets the ttl of k keeping its value, a non positive ttl removes the
+// expiration. It returns false if k doesn't exist
+func (b *BBoltDB) SetTTL(k string, ttl time.Duration) (bool, error) {
+	return setTTL(b, k, ttl)
+}
+
+// sweepChunk is the number of records visited by each read transaction of a sweep
+const sweepChunk = 1000
+
+// expired visits the records in chunks of short read transactions, so that keys can be
+// deleted between them
+func (b *BBoltDB) expired() iter.Seq[string] {
+	return func(yield func(string) bool) {
+		var after []byte
+		for {
+			var (
+				keys []string
+				more bool
+			)
+			err := b.db.View(func(tx *bolt.Tx) error {
+				bucket := tx.Bucket([]byte(b.BucketName))
+				if bucket == nil {
+					return nil
+				}
+				c := bucket.Cursor()
+				key, val := c.First()
+				if after != nil {
+					key, val = c.Seek(after)
+					if bytes.Equal(key, after) {
+						key, val = c.Next()
+					}
+				}
+				for visited := 0; key != nil && visited < sweepChunk; key, val = c.Next() {
+					visited++
+					after = bytes.Clone(key)
+					if _, expires, err := decodeRecord(val); err == nil && isExpired(expires) {
+						keys = append(keys, string(key))
+					}
+				}
+				more = key != nil
+				return nil
+			})
+			if err != nil {
+				return
+			}
+			for _, k := range keys {
+				if !yield(k) {
+					return
+				}
+			}
+			if !more {
+				return
+			}
+		}
+	}
+}
+
+func (b *BBoltDB) deleteExpired(keys []string) (int, error) {
+	deleted := 0
+	err := b.db.Update(func(tx *bolt.Tx) error {
+		bucket := tx.Bucket([]byte(b.BucketName))
+		if bucket == nil {
+			return nil
+		}
+		for _, k := range keys {
+			raw := bucket.Get([]byte(k))
+			if raw == nil {
+				continue
+			}
+			if _, expires, err := decodeRecord(raw); err == nil && isExpired(expires) {
+				if err := bucket.Delete([]byte(k)); err != nil {
+					return err
+				}
+				deleted++
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return 0, err
+	}
+	return deleted, nil
+}
+
+// Counters - returns the lookup counters and the size of the db files, without scanning
+// the records
+func (b *BBoltDB) Counters() Stats {
+	stats := b.counters.stats()
+	stats.DiskBytes = b.Size()
+	return stats
+}
+
+// Stats - returns the statistics of the db, counting the records with a full scan
+func (b *BBoltDB) Stats() Stats {
+	return b.StatsWithKeys(nil)
+}
+
+// StatsWithKeys - returns the statistics of the db, passing the key of each live record to
+// visit during the same scan. The key is only valid during the call
+func (b *BBoltDB) StatsWithKeys(visit func(k []byte)) Stats {
+	stats := b.Counters()
+	_ = b.db.View(func(tx *bolt.Tx) error {
+		bucket := tx.Bucket([]byte(b.BucketName))
+		if bucket == nil {
+			return nil
+		}
+		return bucket.ForEach(func(k, val []byte) error {
+			if v, expires, err := decodeRecord(val); err == nil {
+				stats.count(k, v, isExpired(expires), visit)
+			}
+			return nil
+		})
+	})
+	return stats
+}
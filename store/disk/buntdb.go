@@ -1,18 +1,27 @@
 package disk
 
 import (
-	"strconv"
+	"iter"
+	"net/url"
+	"os"
 	"strings"
 	"sync"
 	"time"
 
+	"github.com/pkg/errors"
 	"github.com/tidwall/buntdb"
 )
 
 // BuntDB - represents a BuntDB implementation
 type BuntDB struct {
-	db *buntdb.DB
+	db   *buntdb.DB
+	path string
 	sync.RWMutex
+	counters counters
+}
+
+func init() {
+	Register("buntdb", openBuntDBBackend)
 }
 
 // OpenBuntDB - Opens the specified path
@@ -24,13 +33,49 @@ func OpenBuntDB(path string) (*BuntDB, error) {
 
 	bdb := new(BuntDB)
 	bdb.db = db
+	bdb.path = path
+
+	return bdb, nil
+}
 
+// openBuntDBBackend opens a buntdb accepting the "sync" policy param (never, everysecond or always)
+func openBuntDBBackend(path string, params url.Values) (DB, error) {
+	bdb, err := OpenBuntDB(path)
+	if err != nil {
+		return nil, err
+	}
+	if value := params.Get("sync"); value != "" {
+		var config buntdb.Config
+		if err := bdb.db.ReadConfig(&config); err != nil {
+			bdb.Close()
+			return nil, err
+		}
+		switch strings.ToLower(value) {
+		case "never":
+			config.SyncPolicy = buntdb.Never
+		case "everysecond":
+			config.SyncPolicy = buntdb.EverySecond
+		case "always":
+			config.SyncPolicy = buntdb.Always
+		default:
+			bdb.Close()
+			return nil, errors.Errorf("invalid sync policy %q", value)
+		}
+		if err := bdb.db.SetConfig(config); err != nil {
+			bdb.Close()
+			return nil, err
+		}
+	}
 	return bdb, nil
 }
 
-// Size - Not implemented
+// Size - returns the size of the append only file in bytes
 func (bdb *BuntDB) Size() int64 {
-	return 0
+	info, err := os.Stat(bdb.path)
+	if err != nil {
+		return 0
+	}
+	return info.Size()
 }
 
 // Close
@@ -45,22 +90,36 @@ func (bdb *BuntDB) GC() error {
 
 // Incr - increment the key by the specified value
 func (bdb *BuntDB) Incr(k string, by int64) (int64, error) {
-	bdb.Lock()
-	defer bdb.Unlock()
+	return incr(bdb, k, by)
+}
 
-	var valP int64
-	err := bdb.db.Update(func(tx *buntdb.Tx) error {
+func (bdb *BuntDB) modify(k string, f modifyFunc) error {
+	return bdb.db.Update(func(tx *buntdb.Tx) error {
+		var (
+			old    []byte
+			exists bool
+			ttl    time.Duration
+		)
 		val, err := tx.Get(k)
+		switch {
+		case err == nil:
+			old, exists = []byte(val), true
+			if d, err := tx.TTL(k); err == nil && d > 0 {
+				ttl = d
+			}
+		case err != buntdb.ErrNotFound:
+			return err
+		}
+		v, ttl, err := f(old, exists, ttl)
 		if err != nil {
 			return err
 		}
-		valP, _ = strconv.ParseInt(val, 10, 64)
-		valP += by
-		_, _, err = tx.Set(k, strconv.FormatInt(valP, 10), nil)
+		opts := new(buntdb.SetOptions)
+		opts.Expires = ttl > 0
+		opts.TTL = ttl
+		_, _, err = tx.Set(k, string(v), opts)
 		return err
 	})
-
-	return valP, err
 }
 
 // Set - sets a key with the specified value and optional ttl
@@ -86,6 +145,38 @@ func (bdb *BuntDB) MSet(data map[string][]byte) error {
 	})
 }
 
+// WriteBatch - commits the batch atomically within a single transaction
+func (bdb *BuntDB) WriteBatch(b *Batch) error {
+	return bdb.db.Update(func(tx *buntdb.Tx) error {
+		return b.replay(
+			func(k string) ([]byte, time.Duration) {
+				v, err := tx.Get(k)
+				if err != nil {
+					return nil, 0
+				}
+				ttl, err := tx.TTL(k)
+				if err != nil || ttl < 0 {
+					ttl = 0
+				}
+				return []byte(v), ttl
+			},
+			func(k string, v []byte, ttl time.Duration) error {
+				opts := new(buntdb.SetOptions)
+				opts.Expires = ttl > 0
+				opts.TTL = ttl
+				_, _, err := tx.Set(k, string(v), opts)
+				return err
+			},
+			func(k string) error {
+				if _, err := tx.Delete(k); err != nil && err != buntdb.ErrNotFound {
+					return err
+				}
+				return nil
+			},
+		)
+	})
+}
+
 // Get - fetches the value of the specified k
 func (bdb *BuntDB) Get(k string) ([]byte, error) {
 	var data []byte
@@ -97,9 +188,32 @@ func (bdb *BuntDB) Get(k string) ([]byte, error) {
 		data = []byte(val)
 		return nil
 	})
+	bdb.counters.lookup(err)
 	return data, err
 }
 
+// GetWithExpiration - fetches the value of the specified k and its expiration time, which is
+// the zero time if it doesn't expire
+func (bdb *BuntDB) GetWithExpiration(k string) ([]byte, time.Time, error) {
+	var (
+		data       []byte
+		expiration time.Time
+	)
+	err := bdb.db.View(func(tx *buntdb.Tx) error {
+		val, err := tx.Get(k)
+		if err != nil {
+			return err
+		}
+		data = []byte(val)
+		if d, err := tx.TTL(k); err == nil && d > 0 {
+			expiration = time.Now().Add(d)
+		}
+		return nil
+	})
+	bdb.counters.lookup(err)
+	return data, expiration, err
+}
+
 // MGet - fetch multiple values of the specified keys
 func (bdb *BuntDB) MGet(keys []string) [][]byte {
 	var data [][]byte
@@ -119,13 +233,18 @@ func (bdb *BuntDB) MGet(keys []string) [][]byte {
 
 // TTL - returns the time to live of the specified key's value
 func (bdb *BuntDB) TTL(key string) int64 {
-	var ttl int64
+	ttl := int64(-2)
 	_ = bdb.db.View(func(tx *buntdb.Tx) error {
 		d, err := tx.TTL(key)
 		if err != nil {
 			return err
 		}
-		ttl = int64(d)
+		if d < 0 {
+			ttl = -1
+			return nil
+		}
+		// round up to the next second as the other backends
+		ttl = int64((d + time.Second - 1) / time.Second)
 		return nil
 	})
 	return ttl
@@ -135,7 +254,7 @@ func (bdb *BuntDB) TTL(key string) int64 {
 func (bdb *BuntDB) MDel(keys []string) error {
 	return bdb.db.Update(func(tx *buntdb.Tx) error {
 		for _, k := range keys {
-			if _, err := tx.Delete(k); err != nil {
+			if _, err := tx.Delete(k); err != nil && err != buntdb.ErrNotFound {
 				return err
 			}
 		}
@@ -147,7 +266,7 @@ func (bdb *BuntDB) MDel(keys []string) error {
 func (bdb *BuntDB) Del(key string) error {
 	return bdb.db.Update(func(tx *buntdb.Tx) error {
 		_, err := tx.Delete(key)
-		if err != nil {
+		if err != nil && err != buntdb.ErrNotFound {
 			return err
 		}
 		return nil
@@ -156,26 +275,32 @@ func (bdb *BuntDB) Del(key string) error {
 
 // Scan - iterate over the whole store using the handler function
 func (bdb *BuntDB) Scan(opt ScannerOptions) error {
-	valid := func(k, v string) bool {
-		// Do not include offset item, skip this
-		if !opt.IncludeOffset && len(opt.Offset) > 0 && k == opt.Offset {
-			return true
-		}
+	return bdb.db.View(func(tx *buntdb.Tx) error {
+		valid := func(k, v string) bool {
+			// Do not include offset item, skip this
+			if !opt.IncludeOffset && len(opt.Offset) > 0 && k == opt.Offset {
+				return true
+			}
 
-		// Do not has prefix, iterate out of bound, exit
-		if len(opt.Prefix) > 0 && !strings.HasPrefix(k, opt.Prefix) {
-			return false
-		}
+			// Do not has prefix, iterate out of bound, exit
+			if len(opt.Prefix) > 0 && !strings.HasPrefix(k, opt.Prefix) {
+				return false
+			}
+
+			// Expired but not yet evicted, skip this
+			if !live(tx, k) {
+				return true
+			}
 
-		if opt.Handler([]byte(k), []byte(v)) != nil {
-			return false
+			if opt.Handler([]byte(k), []byte(v)) != nil {
+				return false
+			}
+			return true
 		}
-		return true
-	}
-	return bdb.db.View(func(tx *buntdb.Tx) error {
+
 		// Has offset
 		if len(opt.Offset) > 0 {
-			return tx.AscendGreaterOrEqual("", opt.Offset, valid)
+			return tx.AscendGreaterOrEqual("", scanStart(opt), valid)
 		}
 
 		// Only prefix
@@ -186,3 +311,99 @@ func (bdb *BuntDB) Scan(opt ScannerOptions) error {
 		return tx.Ascend("", valid)
 	})
 }
+
+// live returns false for the expired items buntdb has not evicted yet
+func live(tx *buntdb.Tx, k string) bool {
+	_, err := tx.TTL(k)
+	return err == nil
+}
+
+// All - returns an iterator over all the items. The iteration runs within a read transaction,
+// so writing to the same db from the loop body will deadlock
+func (bdb *BuntDB) All() iter.Seq2[[]byte, []byte] {
+	return bdb.Prefix("")
+}
+
+// Keys - returns an iterator over all the keys
+func (bdb *BuntDB) Keys() iter.Seq[[]byte] {
+	return keysOf(bdb.All())
+}
+
+// Prefix - returns an iterator over the items whose key starts with p
+func (bdb *BuntDB) Prefix(p string) iter.Seq2[[]byte, []byte] {
+	return func(yield func([]byte, []byte) bool) {
+		_ = bdb.db.View(func(tx *buntdb.Tx) error {
+			return tx.AscendGreaterOrEqual("", p, func(k, v string) bool {
+				if !strings.HasPrefix(k, p) {
+					return false
+				}
+				if !live(tx, k) {
+					return true
+				}
+				return yield([]byte(k), []byte(v))
+			})
+		})
+	}
+}
+
+// Update - atomically replaces the value of k with the one computed by f, preserving its ttl.
+// f can return ErrAbortUpdate to leave the key untouched
+func (bdb *BuntDB) Update(k string, f func(old []byte, exists bool) ([]byte, error)) error {
+	return update(bdb, k, f)
+}
+
+// CompareAndSwap - atomically sets k to new if its current value is old
+func (bdb *BuntDB) CompareAndSwap(k string, old, new []byte) (bool, error) {
+	return compareAndSwap(bdb, k, old, new)
+}
+
+// SetNX - atomically sets k if it doesn't exist
+func (bdb *BuntDB) SetNX(k string, v []byte, ttl time.Duration) (bool, error) {
+	return setNX(bdb, k, v, ttl)
+}
+
+// GetSet - atomically sets k without expiration and returns its previous value, nil if it didn't exist
+func (bdb *BuntDB) GetSet(k string, v []byte) ([]byte, error) {
+	return getSet(bdb, k, v)
+}
+
+// SetTTL - atomically sets the ttl of k keeping its value, a non positive ttl removes the
+// expiration. It returns false if k doesn't exist
+func (bdb *BuntDB) SetTTL(k string, ttl time.Duration) (bool, error) {
+	return setTTL(bdb, k, ttl)
+}
+
+// expired yields nothing as buntdb deletes the expired records on its own
+func (bdb *BuntDB) expired() iter.Seq[string] {
+	return func(yield func(string) bool) {}
+}
+
+func (bdb *BuntDB) deleteExpired(keys []string) (int, error) {
+	return 0, nil
+}
+
+// Counters - returns the lookup counters and the size of the db files, without scanning
+// the records
+func (bdb *BuntDB) Counters() Stats {
+	stats := bdb.counters.stats()
+	stats.DiskBytes = bdb.Size()
+	return stats
+}
+
+// Stats - returns the statistics of the db, counting the records with a full scan
+func (bdb *BuntDB) Stats() Stats {
+	return bdb.StatsWithKeys(nil)
+}
+
+// StatsWithKeys - returns the statistics of the db, passing the key of each live record to
+// visit during the same scan. The key is only valid during the call
+func (bdb *BuntDB) StatsWithKeys(visit func(k []byte)) Stats {
+	stats := bdb.Counters()
+	_ = bdb.db.View(func(tx *buntdb.Tx) error {
+		return tx.Ascend("", func(k, v string) bool {
+			stats.count([]byte(k), []byte(v), !live(tx, k), visit)
+			return true
+		})
+	})
+	return stats
+}
@@ -0,0 +1,20 @@
+package disk_test
+
+import (
+	"path/filepath"
+	"testing"
+
+	"github.com/projectdiscovery/hmap/store/disk"
+	"github.com/projectdiscovery/hmap/store/disk/dbtest"
+)
+
+func TestConformance(t *testing.T) {
+	for _, name := range []string{"leveldb", "pogreb", "bbolt", "buntdb"} {
+		name := name
+		t.Run(name, func(t *testing.T) {
+			dbtest.Run(t, func(path string) (disk.DB, error) {
+				return disk.OpenBackend(name, filepath.Join(path, name), nil)
+			})
+		})
+	}
+}
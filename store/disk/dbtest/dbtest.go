@@ -0,0 +1,702 @@
+// Package dbtest provides the behavioural contracts every disk.DB implementation must honor,
+// so that built-in and third-party backends can verify they are interchangeable:
+//
+//	func TestConformance(t *testing.T) {
+//		dbtest.Run(t, func(path string) (disk.DB, error) {
+//			return mybackend.Open(filepath.Join(path, "db"))
+//		})
+//	}
+package dbtest
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/projectdiscovery/hmap/store/disk"
+)
+
+// Opener opens an empty db within the path folder, which is removed once the test ends
+type Opener func(path string) (disk.DB, error)
+
+// Contract - represents a behaviour every implementation must honor
+type Contract struct {
+	Name string
+	Run  func(t *testing.T, db disk.DB)
+}
+
+// Contracts - returns the conformance suite
+func Contracts() []Contract {
+	return []Contract{
+		{"SetGet", testSetGet},
+		{"TTL", testTTL},
+		{"GetWithExpiration", testGetWithExpiration},
+		{"Expiry", testExpiry},
+		{"Incr", testIncr},
+		{"MSetMGetMDel", testMulti},
+		{"WriteBatch", testWriteBatch},
+		{"WriteBatchIncrTTL", testWriteBatchIncrTTL},
+		{"Update", testUpdate},
+		{"CompareAndSwap", testCompareAndSwap},
+		{"SetNX", testSetNX},
+		{"GetSet", testGetSet},
+		{"SetTTL", testSetTTL},
+		{"Scan", testScan},
+		{"ScanPrefix", testScanPrefix},
+		{"ScanOffset", testScanOffset},
+		{"ScanStop", testScanStop},
+		{"Iterators", testIterators},
+		{"Size", testSize},
+		{"Stats", testStats},
+		{"Concurrency", testConcurrency},
+		{"ClaimExpired", testClaimExpired},
+		{"Sweeper", testSweeper},
+		{"CloseIdempotence", testCloseIdempotence},
+	}
+}
+
+// Run runs every contract as a subtest against a fresh db returned by open
+func Run(t *testing.T, open Opener) {
+	for _, contract := range Contracts() {
+		contract := contract
+		t.Run(contract.Name, func(t *testing.T) {
+			db, err := open(t.TempDir())
+			if errors.Is(err, disk.ErrNotSupported) {
+				t.Skip(err)
+			}
+			if err != nil {
+				t.Fatalf("open: %s", err)
+			}
+			defer db.Close()
+			contract.Run(t, db)
+		})
+	}
+}
+
+func mustSet(t *testing.T, db disk.DB, k, v string, ttl time.Duration) {
+	t.Helper()
+	if err := db.Set(k, []byte(v), ttl); err != nil {
+		t.Fatalf("set %q: %s", k, err)
+	}
+}
+
+// scanKeys returns the sorted keys visited by a scan with opt
+func scanKeys(t *testing.T, db disk.DB, opt disk.ScannerOptions) []string {
+	t.Helper()
+	var keys []string
+	opt.Handler = func(k, _ []byte) error {
+		keys = append(keys, string(k))
+		return nil
+	}
+	if err := db.Scan(opt); err != nil {
+		t.Fatalf("scan: %s", err)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+func equalKeys(t *testing.T, got, want []string) {
+	t.Helper()
+	if fmt.Sprint(got) != fmt.Sprint(want) {
+		t.Fatalf("got keys %v, want %v", got, want)
+	}
+}
+
+func testSetGet(t *testing.T, db disk.DB) {
+	mustSet(t, db, "k", "v", 0)
+	v, err := db.Get("k")
+	if err != nil || string(v) != "v" {
+		t.Fatalf("get: got %q (%v), want %q", v, err, "v")
+	}
+	mustSet(t, db, "k", "overwritten", 0)
+	if v, _ := db.Get("k"); string(v) != "overwritten" {
+		t.Fatalf("get after overwrite: got %q", v)
+	}
+	mustSet(t, db, "empty", "", 0)
+	if v, err := db.Get("empty"); err != nil || len(v) != 0 {
+		t.Fatalf("get empty value: got %q (%v)", v, err)
+	}
+	if _, err := db.Get("missing"); err == nil {
+		t.Fatal("get of a missing key must fail")
+	}
+	if err := db.Del("k"); err != nil {
+		t.Fatalf("del: %s", err)
+	}
+	if _, err := db.Get("k"); err == nil {
+		t.Fatal("get of a deleted key must fail")
+	}
+	if err := db.Del("missing"); err != nil {
+		t.Fatalf("del of a missing key: %s", err)
+	}
+}
+
+func testTTL(t *testing.T, db disk.DB) {
+	mustSet(t, db, "persistent", "v", 0)
+	mustSet(t, db, "volatile", "v", time.Hour)
+	if ttl := db.TTL("persistent"); ttl != -1 {
+		t.Fatalf("ttl of a key without expiration: got %d, want -1", ttl)
+	}
+	if ttl := db.TTL("missing"); ttl != -2 {
+		t.Fatalf("ttl of a missing key: got %d, want -2", ttl)
+	}
+	// seconds, rounded up
+	if ttl := db.TTL("volatile"); ttl < 3590 || ttl > 3600 {
+		t.Fatalf("ttl of a key expiring in an hour: got %d, want seconds", ttl)
+	}
+}
+
+func testGetWithExpiration(t *testing.T, db disk.DB) {
+	mustSet(t, db, "persistent", "v", 0)
+	mustSet(t, db, "volatile", "v", 1500*time.Millisecond)
+	deadline := time.Now().Add(1500 * time.Millisecond)
+	v, expiration, err := db.GetWithExpiration("persistent")
+	if err != nil || string(v) != "v" || !expiration.IsZero() {
+		t.Fatalf("get with expiration of a key without expiration: got %q, %s (%v)", v, expiration, err)
+	}
+	// the expiration is not rounded to seconds
+	v, expiration, err = db.GetWithExpiration("volatile")
+	if err != nil || string(v) != "v" {
+		t.Fatalf("get with expiration: got %q (%v)", v, err)
+	}
+	if d := deadline.Sub(expiration); d < 0 || d > 100*time.Millisecond {
+		t.Fatalf("expiration must be exact: got %s, want about %s", expiration, deadline)
+	}
+	if _, _, err := db.GetWithExpiration("missing"); err == nil {
+		t.Fatal("get with expiration of a missing key must fail")
+	}
+}
+
+func testExpiry(t *testing.T, db disk.DB) {
+	mustSet(t, db, "short", "v", 300*time.Millisecond)
+	mustSet(t, db, "long", "v", time.Hour)
+	if v, err := db.Get("short"); err != nil || string(v) != "v" {
+		t.Fatalf("get before expiration: got %q (%v)", v, err)
+	}
+	time.Sleep(500 * time.Millisecond)
+	equalKeys(t, scanKeys(t, db, disk.ScannerOptions{}), []string{"long"})
+	var keys []string
+	for k := range db.Keys() {
+		keys = append(keys, string(k))
+	}
+	equalKeys(t, keys, []string{"long"})
+	if _, err := db.Get("short"); err == nil {
+		t.Fatal("get of an expired key must fail")
+	}
+	if ttl := db.TTL("short"); ttl != -2 {
+		t.Fatalf("ttl of an expired key: got %d, want -2", ttl)
+	}
+}
+
+func testIncr(t *testing.T, db disk.DB) {
+	for i, want := range []int64{5, 3, 103} {
+		by := []int64{5, -2, 100}[i]
+		n, err := db.Incr("counter", by)
+		if err != nil || n != want {
+			t.Fatalf("incr by %d: got %d (%v), want %d", by, n, err, want)
+		}
+	}
+	v, err := db.Get("counter")
+	if err != nil || string(v) != "103" {
+		t.Fatalf("counters are stored as decimals: got %q (%v)", v, err)
+	}
+	mustSet(t, db, "volatile", "1", time.Hour)
+	if _, err := db.Incr("volatile", 1); err != nil {
+		t.Fatalf("incr: %s", err)
+	}
+	if ttl := db.TTL("volatile"); ttl <= 0 {
+		t.Fatalf("incr must preserve the ttl: got %d", ttl)
+	}
+}
+
+func testMulti(t *testing.T, db disk.DB) {
+	data := map[string][]byte{"a": []byte("1"), "b": []byte("2"), "c": []byte("3")}
+	if err := db.MSet(data); err != nil {
+		t.Fatalf("mset: %s", err)
+	}
+	values := db.MGet([]string{"a", "missing", "c"})
+	if len(values) != 3 || string(values[0]) != "1" || len(values[1]) != 0 || string(values[2]) != "3" {
+		t.Fatalf("mget must return a value per key in order, empty if missing: got %q", values)
+	}
+	if err := db.MDel([]string{"a", "b", "missing"}); err != nil {
+		t.Fatalf("mdel: %s", err)
+	}
+	equalKeys(t, scanKeys(t, db, disk.ScannerOptions{}), []string{"c"})
+}
+
+func testWriteBatch(t *testing.T, db disk.DB) {
+	mustSet(t, db, "counter", "10", 0)
+	b := disk.NewBatch()
+	b.Put("a", []byte("1"), 0)
+	b.Put("b", []byte("2"), time.Hour)
+	b.Incr("counter", 5)
+	b.Incr("missing", 2)
+	b.Incr("missing", 3)
+	b.Delete("a")
+	if err := db.WriteBatch(b); err != nil {
+		t.Fatalf("write batch: %s", err)
+	}
+	// operations apply in order, seeing the previous ones
+	if _, err := db.Get("a"); err == nil {
+		t.Fatal("a key deleted by the batch must be missing")
+	}
+	for k, want := range map[string]string{"b": "2", "counter": "15", "missing": "5"} {
+		if v, err := db.Get(k); err != nil || string(v) != want {
+			t.Fatalf("get %q after the batch: got %q (%v), want %q", k, v, err, want)
+		}
+	}
+	if ttl := db.TTL("b"); ttl <= 0 {
+		t.Fatalf("batch puts must honor the ttl: got %d", ttl)
+	}
+}
+
+func testWriteBatchIncrTTL(t *testing.T, db disk.DB) {
+	mustSet(t, db, "stored", "1", time.Hour)
+	mustSet(t, db, "persistent", "1", 0)
+	b := disk.NewBatch()
+	b.Incr("stored", 1)
+	b.Put("staged", []byte("1"), time.Hour)
+	b.Incr("staged", 1)
+	b.Incr("persistent", 1)
+	if err := db.WriteBatch(b); err != nil {
+		t.Fatalf("write batch: %s", err)
+	}
+	// increments keep the ttl of the stored key or of a previous put, as Incr does
+	for _, k := range []string{"stored", "staged"} {
+		if v, _ := db.Get(k); string(v) != "2" {
+			t.Fatalf("get %q after the batch: got %q, want 2", k, v)
+		}
+		if ttl := db.TTL(k); ttl <= 0 {
+			t.Fatalf("batch increments must keep the ttl of %q: got %d", k, ttl)
+		}
+	}
+	if ttl := db.TTL("persistent"); ttl != -1 {
+		t.Fatalf("batch increments must not add a ttl: got %d", ttl)
+	}
+}
+
+func testUpdate(t *testing.T, db disk.DB) {
+	err := db.Update("k", func(old []byte, exists bool) ([]byte, error) {
+		if exists || old != nil {
+			t.Fatalf("update of a missing key: got %q (exists %t)", old, exists)
+		}
+		return []byte("v"), nil
+	})
+	if err != nil {
+		t.Fatalf("update: %s", err)
+	}
+	mustSet(t, db, "volatile", "v", time.Hour)
+	err = db.Update("volatile", func(old []byte, exists bool) ([]byte, error) {
+		if !exists || string(old) != "v" {
+			t.Fatalf("update of an existing key: got %q (exists %t)", old, exists)
+		}
+		return append(old, '!'), nil
+	})
+	if err != nil {
+		t.Fatalf("update: %s", err)
+	}
+	if v, _ := db.Get("volatile"); string(v) != "v!" {
+		t.Fatalf("get after update: got %q", v)
+	}
+	if ttl := db.TTL("volatile"); ttl <= 0 {
+		t.Fatalf("update must preserve the ttl: got %d", ttl)
+	}
+	err = db.Update("volatile", func(old []byte, exists bool) ([]byte, error) {
+		return nil, disk.ErrAbortUpdate
+	})
+	if err != nil {
+		t.Fatalf("an aborted update must not fail: %s", err)
+	}
+	if v, _ := db.Get("volatile"); string(v) != "v!" {
+		t.Fatalf("an aborted update must leave the key untouched: got %q", v)
+	}
+	failure := errors.New("failure")
+	err = db.Update("volatile", func(old []byte, exists bool) ([]byte, error) {
+		return nil, failure
+	})
+	if !errors.Is(err, failure) {
+		t.Fatalf("update must return the error of f: got %v", err)
+	}
+}
+
+func testCompareAndSwap(t *testing.T, db disk.DB) {
+	if ok, err := db.CompareAndSwap("missing", nil, []byte("v")); err != nil || ok {
+		t.Fatalf("compare and swap of a missing key: got %t (%v)", ok, err)
+	}
+	mustSet(t, db, "k", "old", time.Hour)
+	if ok, err := db.CompareAndSwap("k", []byte("other"), []byte("new")); err != nil || ok {
+		t.Fatalf("compare and swap with a different value: got %t (%v)", ok, err)
+	}
+	if ok, err := db.CompareAndSwap("k", []byte("old"), []byte("new")); err != nil || !ok {
+		t.Fatalf("compare and swap: got %t (%v)", ok, err)
+	}
+	if v, _ := db.Get("k"); string(v) != "new" {
+		t.Fatalf("get after compare and swap: got %q", v)
+	}
+	if ttl := db.TTL("k"); ttl <= 0 {
+		t.Fatalf("compare and swap must preserve the ttl: got %d", ttl)
+	}
+}
+
+func testSetNX(t *testing.T, db disk.DB) {
+	const workers = 16
+	var (
+		wg      sync.WaitGroup
+		claimed atomic.Int32
+	)
+	for w := 0; w < workers; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			ok, err := db.SetNX("target", []byte("claimed"), time.Hour)
+			if err != nil {
+				t.Errorf("setnx: %s", err)
+			}
+			if ok {
+				claimed.Add(1)
+			}
+		}()
+	}
+	wg.Wait()
+	if n := claimed.Load(); n != 1 {
+		t.Fatalf("concurrent workers must claim a key exactly once: claimed %d times", n)
+	}
+	if ttl := db.TTL("target"); ttl <= 0 {
+		t.Fatalf("setnx must honor the ttl: got %d", ttl)
+	}
+	if v, _ := db.Get("target"); string(v) != "claimed" {
+		t.Fatalf("get after setnx: got %q", v)
+	}
+}
+
+func testGetSet(t *testing.T, db disk.DB) {
+	old, err := db.GetSet("k", []byte("first"))
+	if err != nil || old != nil {
+		t.Fatalf("getset of a missing key: got %q (%v), want nil", old, err)
+	}
+	mustSet(t, db, "k", "second", time.Hour)
+	old, err = db.GetSet("k", []byte("third"))
+	if err != nil || string(old) != "second" {
+		t.Fatalf("getset: got %q (%v), want %q", old, err, "second")
+	}
+	if v, _ := db.Get("k"); string(v) != "third" {
+		t.Fatalf("get after getset: got %q", v)
+	}
+	if ttl := db.TTL("k"); ttl != -1 {
+		t.Fatalf("getset must remove the ttl: got %d", ttl)
+	}
+}
+
+func testSetTTL(t *testing.T, db disk.DB) {
+	if found, err := db.SetTTL("missing", time.Hour); err != nil || found {
+		t.Fatalf("set ttl of a missing key: got %t (%v)", found, err)
+	}
+	if _, err := db.Get("missing"); err == nil {
+		t.Fatal("set ttl must not create a missing key")
+	}
+	mustSet(t, db, "k", "v", 0)
+	if found, err := db.SetTTL("k", time.Hour); err != nil || !found {
+		t.Fatalf("set ttl: got %t (%v)", found, err)
+	}
+	if ttl := db.TTL("k"); ttl <= 0 {
+		t.Fatalf("set ttl must set the ttl: got %d", ttl)
+	}
+	if found, err := db.SetTTL("k", 0); err != nil || !found {
+		t.Fatalf("set ttl: got %t (%v)", found, err)
+	}
+	if ttl := db.TTL("k"); ttl != -1 {
+		t.Fatalf("a zero ttl must remove the expiration: got %d", ttl)
+	}
+	if v, _ := db.Get("k"); string(v) != "v" {
+		t.Fatalf("set ttl must keep the value: got %q", v)
+	}
+}
+
+func seedScan(t *testing.T, db disk.DB) {
+	for i := 0; i < 10; i++ {
+		mustSet(t, db, fmt.Sprintf("a%d", i), strconv.Itoa(i), 0)
+	}
+	for i := 0; i < 5; i++ {
+		mustSet(t, db, fmt.Sprintf("b%d", i), strconv.Itoa(i), 0)
+	}
+}
+
+func testScan(t *testing.T, db disk.DB) {
+	seedScan(t, db)
+	values := make(map[string]string)
+	err := db.Scan(disk.ScannerOptions{
+		Handler: func(k, v []byte) error {
+			values[string(k)] = string(v)
+			return nil
+		},
+	})
+	if err != nil {
+		t.Fatalf("scan: %s", err)
+	}
+	if len(values) != 15 || values["a3"] != "3" || values["b4"] != "4" {
+		t.Fatalf("scan must visit every item with its value: got %v", values)
+	}
+}
+
+func testScanPrefix(t *testing.T, db disk.DB) {
+	seedScan(t, db)
+	equalKeys(t, scanKeys(t, db, disk.ScannerOptions{Prefix: "b"}), []string{"b0", "b1", "b2", "b3", "b4"})
+	equalKeys(t, scanKeys(t, db, disk.ScannerOptions{Prefix: "c"}), nil)
+}
+
+func testScanOffset(t *testing.T, db disk.DB) {
+	seedScan(t, db)
+	equalKeys(t, scanKeys(t, db, disk.ScannerOptions{Prefix: "a", Offset: "a6"}), []string{"a7", "a8", "a9"})
+	equalKeys(t, scanKeys(t, db, disk.ScannerOptions{Prefix: "a", Offset: "a6", IncludeOffset: true}), []string{"a6", "a7", "a8", "a9"})
+	equalKeys(t, scanKeys(t, db, disk.ScannerOptions{Offset: "b2", IncludeOffset: true}), []string{"b2", "b3", "b4"})
+	// an offset before the prefix starts from the prefix
+	equalKeys(t, scanKeys(t, db, disk.ScannerOptions{Prefix: "b", Offset: "a"}), []string{"b0", "b1", "b2", "b3", "b4"})
+}
+
+func testScanStop(t *testing.T, db disk.DB) {
+	seedScan(t, db)
+	visited := 0
+	_ = db.Scan(disk.ScannerOptions{
+		Handler: func(k, v []byte) error {
+			visited++
+			return errors.New("stop")
+		},
+	})
+	if visited != 1 {
+		t.Fatalf("a handler error must stop the scan: visited %d items", visited)
+	}
+}
+
+func testIterators(t *testing.T, db disk.DB) {
+	seedScan(t, db)
+	all := 0
+	for range db.All() {
+		all++
+	}
+	var keys []string
+	for k := range db.Keys() {
+		keys = append(keys, string(k))
+	}
+	var prefixed []string
+	for k, v := range db.Prefix("b") {
+		if string(v) != string(k[1:]) {
+			t.Fatalf("prefix: got value %q for key %q", v, k)
+		}
+		prefixed = append(prefixed, string(k))
+	}
+	sort.Strings(prefixed)
+	if all != 15 || len(keys) != 15 {
+		t.Fatalf("all and keys must visit every item: got %d and %d", all, len(keys))
+	}
+	equalKeys(t, prefixed, []string{"b0", "b1", "b2", "b3", "b4"})
+	for range db.All() {
+		// breaking out early must release the iteration
+		break
+	}
+	mustSet(t, db, "after", "break", 0)
+}
+
+func testSize(t *testing.T, db disk.DB) {
+	for i := 0; i < 100; i++ {
+		mustSet(t, db, strconv.Itoa(i), "value", 0)
+	}
+	// backends may account for buffered writes lazily, but never report a negative size
+	if size := db.Size(); size < 0 {
+		t.Fatalf("size must be a number of bytes: got %d", size)
+	}
+	if err := db.GC(); err != nil && !errors.Is(err, disk.ErrNotImplemented) {
+		t.Fatalf("gc: %s", err)
+	}
+}
+
+func testStats(t *testing.T, db disk.DB) {
+	mustSet(t, db, "a", "12345", 0)
+	mustSet(t, db, "b", "12345", time.Hour)
+	mustSet(t, db, "short", "v", 100*time.Millisecond)
+	time.Sleep(200 * time.Millisecond)
+	_, _ = db.Get("a")
+	_, _ = db.Get("missing")
+
+	stats := db.Stats()
+	if stats.Items != 2 || stats.Bytes != 12 {
+		t.Fatalf("stats must count the live records: got %d items of %d bytes, want 2 of 12", stats.Items, stats.Bytes)
+	}
+	// the expired record may have been deleted already
+	if stats.Expired > 1 {
+		t.Fatalf("stats must count the expired records: got %d", stats.Expired)
+	}
+	if stats.Hits != 1 || stats.Misses != 1 {
+		t.Fatalf("stats must count the lookups: got %d hits and %d misses", stats.Hits, stats.Misses)
+	}
+	if stats.DiskBytes != db.Size() {
+		t.Fatalf("disk bytes must match size: got %d, want %d", stats.DiskBytes, db.Size())
+	}
+
+	var keys []string
+	if withKeys := db.StatsWithKeys(func(k []byte) {
+		keys = append(keys, string(k))
+	}); withKeys.Items != stats.Items {
+		t.Fatalf("stats with keys must match the stats: got %d items, want %d", withKeys.Items, stats.Items)
+	}
+	sort.Strings(keys)
+	equalKeys(t, keys, []string{"a", "b"})
+
+	counters := db.Counters()
+	if counters.Items != 0 || counters.Bytes != 0 || counters.Expired != 0 {
+		t.Fatalf("counters must not count the records: got %+v", counters)
+	}
+	if counters.Hits != stats.Hits || counters.Misses != stats.Misses || counters.DiskBytes != db.Size() {
+		t.Fatalf("counters must match the stats: got %+v, want %+v", counters, stats)
+	}
+}
+
+func testConcurrency(t *testing.T, db disk.DB) {
+	const workers, iterations = 8, 50
+	var wg sync.WaitGroup
+	errs := make(chan error, workers)
+	for w := 0; w < workers; w++ {
+		wg.Add(1)
+		go func(w int) {
+			defer wg.Done()
+			for i := 0; i < iterations; i++ {
+				k := fmt.Sprintf("w%d-%d", w, i)
+				if err := db.Set(k, []byte(k), 0); err != nil {
+					errs <- err
+					return
+				}
+				if v, err := db.Get(k); err != nil || string(v) != k {
+					errs <- fmt.Errorf("get %q: got %q (%v)", k, v, err)
+					return
+				}
+				if _, err := db.Incr("counter", 1); err != nil {
+					errs <- err
+					return
+				}
+			}
+		}(w)
+	}
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		t.Fatal(err)
+	}
+	if v, _ := db.Get("counter"); string(v) != strconv.Itoa(workers*iterations) {
+		t.Fatalf("concurrent increments must not be lost: got %q, want %d", v, workers*iterations)
+	}
+}
+
+func testClaimExpired(t *testing.T, db disk.DB) {
+	const keys, workers = 50, 4
+	for i := 0; i < keys; i++ {
+		mustSet(t, db, strconv.Itoa(i), "expired", time.Millisecond)
+	}
+	time.Sleep(10 * time.Millisecond)
+	// reads deleting the expired records must not delete a racing claim
+	for i := 0; i < keys; i++ {
+		k := strconv.Itoa(i)
+		var (
+			wg      sync.WaitGroup
+			claimed atomic.Int32
+		)
+		for w := 0; w < workers; w++ {
+			wg.Add(2)
+			go func() {
+				defer wg.Done()
+				for j := 0; j < 10; j++ {
+					_, _ = db.Get(k)
+				}
+			}()
+			go func() {
+				defer wg.Done()
+				ok, err := db.SetNX(k, []byte("claimed"), time.Hour)
+				if err != nil {
+					t.Errorf("setnx %q: %s", k, err)
+				}
+				if ok {
+					claimed.Add(1)
+				}
+			}()
+		}
+		wg.Wait()
+		if n := claimed.Load(); n != 1 {
+			t.Fatalf("an expired key must be claimed exactly once: claimed %d times", n)
+		}
+	}
+}
+
+func testSweeper(t *testing.T, db disk.DB) {
+	for i := 0; i < 50; i++ {
+		mustSet(t, db, fmt.Sprintf("expiring-%d", i), "v", 100*time.Millisecond)
+	}
+	for i := 0; i < 10; i++ {
+		mustSet(t, db, fmt.Sprintf("persistent-%d", i), "v", 0)
+	}
+	time.Sleep(200 * time.Millisecond)
+
+	sweeps := make(chan int, 16)
+	sweeper, err := disk.NewSweeper(db, disk.SweeperOptions{
+		Interval:  50 * time.Millisecond,
+		BatchSize: 7,
+		OnSweep: func(reclaimed int, err error) {
+			if err != nil {
+				t.Errorf("sweep: %s", err)
+			}
+			select {
+			case sweeps <- reclaimed:
+			default:
+			}
+		},
+	})
+	if errors.Is(err, disk.ErrNotSupported) {
+		t.Skip("the backend doesn't support sweeping")
+	}
+	if err != nil {
+		t.Fatalf("new sweeper: %s", err)
+	}
+	defer sweeper.Stop()
+
+	// backends expiring the records on their own have nothing to reclaim
+	deadline := time.After(5 * time.Second)
+	for db.Stats().Expired > 0 {
+		select {
+		case <-sweeps:
+		case <-deadline:
+			t.Fatalf("the expired records must be deleted: %d left", db.Stats().Expired)
+		}
+	}
+	sweeper.Stop()
+	if n := sweeper.Reclaimed(); n > 50 {
+		t.Fatalf("reclaimed more keys than expired: %d", n)
+	}
+	if stats := db.Stats(); stats.Items != 10 {
+		t.Fatalf("the sweeper must only delete the expired records: got %d items, want 10", stats.Items)
+	}
+
+	// manual sweeps in batches with a rate limit
+	for i := 0; i < 5; i++ {
+		mustSet(t, db, fmt.Sprintf("expiring-%d", i), "v", 10*time.Millisecond)
+	}
+	time.Sleep(50 * time.Millisecond)
+	limited, err := disk.NewSweeper(db, disk.SweeperOptions{Interval: time.Hour, BatchSize: 2, Rate: 1000})
+	if err != nil {
+		t.Fatalf("new sweeper: %s", err)
+	}
+	defer limited.Stop()
+	n, err := limited.Sweep()
+	if err != nil || n > 5 {
+		t.Fatalf("sweep: got %d (%v), want at most 5", n, err)
+	}
+	if expired := db.Stats().Expired; expired > int64(5-n) {
+		t.Fatalf("a sweep must delete the expired records it reclaims: %d left after reclaiming %d", expired, n)
+	}
+}
+
+func testCloseIdempotence(t *testing.T, db disk.DB) {
+	mustSet(t, db, "k", "v", 0)
+	db.Close()
+	db.Close()
+}
@@ -3,5 +3,8 @@ package disk
 const Megabyte = 1 << 20
 
 var (
+	// OpenPogrebDB opens a pogreb db, or returns ErrNotSupported on platforms lacking it.
+	//
+	// Deprecated: use OpenBackend("pogreb", path, nil) or Open("pogreb://path")
 	OpenPogrebDB func(string) (DB, error)
 )
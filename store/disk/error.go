@@ -3,8 +3,13 @@ package disk
 import "github.com/pkg/errors"
 
 var (
-	ErrNotImplemented = errors.New("not implemented")
-	ErrNotFound       = errors.New("not found")
-	ErrNoData         = errors.New("no data")
-	ErrNotSupported   = errors.New("not supported")
+	ErrNotImplemented  = errors.New("not implemented")
+	ErrNotFound        = errors.New("not found")
+	ErrNoData          = errors.New("no data")
+	ErrNotSupported    = errors.New("not supported")
+	ErrAbortUpdate     = errors.New("update aborted")
+	ErrCorruptedRecord = errors.New("corrupted record")
+
+	// errExpired is returned by the internal lookups of expired records not deleted yet
+	errExpired = errors.New("expired")
 )
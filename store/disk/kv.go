@@ -1,19 +1,35 @@
 package disk
 
-import "time"
+import (
+	"iter"
+	"time"
+)
 
 // DB Interface
 type DB interface {
 	Incr(k string, by int64) (int64, error)
+	Update(k string, f func(old []byte, exists bool) ([]byte, error)) error
+	CompareAndSwap(k string, old, new []byte) (bool, error)
+	SetNX(k string, v []byte, ttl time.Duration) (bool, error)
+	GetSet(k string, v []byte) ([]byte, error)
+	SetTTL(k string, ttl time.Duration) (bool, error)
 	Set(k string, v []byte, ttl time.Duration) error
 	MSet(data map[string][]byte) error
+	WriteBatch(b *Batch) error
 	Get(k string) ([]byte, error)
+	GetWithExpiration(k string) ([]byte, time.Time, error)
 	MGet(keys []string) [][]byte
 	TTL(key string) int64
 	MDel(keys []string) error
 	Del(key string) error
 	Scan(ScannerOpt ScannerOptions) error
+	All() iter.Seq2[[]byte, []byte]
+	Keys() iter.Seq[[]byte]
+	Prefix(p string) iter.Seq2[[]byte, []byte]
 	Size() int64
+	Stats() Stats
+	StatsWithKeys(visit func(k []byte)) Stats
+	Counters() Stats
 	GC() error
 	Close()
 }
@@ -35,3 +51,27 @@ type ScannerOptions struct {
 	// the handler that handles the incoming data
 	Handler func(k []byte, v []byte) error
 }
+
+// scanStart returns the key from which a sorted scan starts
+func scanStart(opt ScannerOptions) string {
+	if opt.Prefix > opt.Offset {
+		return opt.Prefix
+	}
+	return opt.Offset
+}
+
+// skipOffset returns true if the key is the offset and it must be excluded
+func skipOffset(opt ScannerOptions, k []byte) bool {
+	return !opt.IncludeOffset && opt.Offset != "" && string(k) == opt.Offset
+}
+
+// keysOf adapts a key-value sequence to a key only one
+func keysOf(seq iter.Seq2[[]byte, []byte]) iter.Seq[[]byte] {
+	return func(yield func([]byte) bool) {
+		for k := range seq {
+			if !yield(k) {
+				return
+			}
+		}
+	}
+}
@@ -1,10 +1,13 @@
 package disk
 
 import (
+	"fmt"
+	"net/url"
 	"os"
 	"path/filepath"
 	"runtime"
 	"testing"
+	"time"
 
 	"github.com/projectdiscovery/hmap/filekv"
 	fileutil "github.com/projectdiscovery/utils/file"
@@ -75,3 +78,95 @@ func TestFileKV(t *testing.T) {
 	})
 	require.Equalf(t, 3, count, "wanted 3 but got %d", count)
 }
+
+func TestRegistry(t *testing.T) {
+	require.Subset(t, Backends(), []string{"bbolt", "buntdb", "leveldb", "pogreb"})
+
+	dbpath, _ := utiltestGetPath(t)
+	db, err := Open("leveldb://" + filepath.ToSlash(dbpath) + "?compaction=4MB&cache=1MB")
+	require.Nil(t, err)
+	require.Nil(t, db.Set("a", []byte("1"), 0))
+	utiltestRemoveDb(t, db, dbpath)
+
+	dbpath, _ = utiltestGetPath(t)
+	db, err = Open("bbolt://" + filepath.ToSlash(filepath.Join(dbpath, "bb")) + "?bucket=hosts&timeout=1s")
+	require.Nil(t, err)
+	require.Equal(t, "hosts", db.(*BBoltDB).BucketName)
+	utiltestRemoveDb(t, db, dbpath)
+
+	_, err = Open("leveldb://" + filepath.ToSlash(dbpath) + "?compaction=huge")
+	require.NotNil(t, err)
+	_, err = Open("missing:///tmp/db")
+	require.ErrorIs(t, err, ErrNotSupported)
+	_, err = Open("/tmp/db")
+	require.NotNil(t, err)
+
+	// third party backends plug in by name
+	var opened string
+	name := fmt.Sprintf("custom-%d", time.Now().UnixNano())
+	Register(name, func(path string, params url.Values) (DB, error) {
+		opened = path + "?" + params.Encode()
+		return OpenLevelDB(path)
+	})
+	require.Panics(t, func() { Register(name, openLevelDBBackend) })
+	dbpath, _ = utiltestGetPath(t)
+	db, err = OpenBackend(name, dbpath, url.Values{"x": {"1"}})
+	require.Nil(t, err)
+	require.Equal(t, dbpath+"?x=1", opened)
+	utiltestRemoveDb(t, db, dbpath)
+}
+
+func TestRecordEnvelope(t *testing.T) {
+	v, expires, err := decodeRecord(encodeRecord([]byte("value"), 0))
+	require.Nil(t, err)
+	require.Equal(t, "value", string(v))
+	require.Zero(t, expires)
+
+	v, expires, err = decodeRecord(encodeRecord([]byte("value"), 1500*time.Millisecond))
+	require.Nil(t, err)
+	require.Equal(t, "value", string(v))
+	require.InDelta(t, time.Now().Add(1500*time.Millisecond).UnixNano(), expires, float64(time.Second))
+
+	// the legacy ascii format is still readable
+	v, expires, err = decodeRecord([]byte("1700000000;legacy;value"))
+	require.Nil(t, err)
+	require.Equal(t, "legacy;value", string(v))
+	require.Equal(t, time.Unix(1700000000, 0).UnixNano(), expires)
+
+	corrupted := encodeRecord([]byte("value"), 0)
+	corrupted[len(corrupted)-1] ^= 0xff
+	for _, raw := range [][]byte{corrupted, corrupted[:8], []byte("no separator"), []byte("abc;value")} {
+		_, _, err = decodeRecord(raw)
+		require.ErrorIs(t, err, ErrCorruptedRecord)
+	}
+
+	dbpath, _ := utiltestGetPath(t)
+	ldb, err := OpenLevelDB(dbpath)
+	require.Nil(t, err)
+	defer utiltestRemoveDb(t, ldb, dbpath)
+
+	require.Nil(t, ldb.db.Put([]byte("legacy"), []byte("0;old"), nil))
+	require.Nil(t, ldb.db.Put([]byte("corrupted"), []byte("garbage"), nil))
+	v, err = ldb.Get("legacy")
+	require.Nil(t, err)
+	require.Equal(t, "old", string(v))
+	require.Equal(t, int64(-1), ldb.TTL("legacy"))
+	_, err = ldb.Get("corrupted")
+	require.ErrorIs(t, err, ErrCorruptedRecord)
+	require.ErrorIs(t, ldb.Scan(ScannerOptions{Handler: func(k, v []byte) error { return nil }}), ErrCorruptedRecord)
+
+	// legacy records are upgraded on write
+	require.Nil(t, ldb.Update("legacy", func(old []byte, exists bool) ([]byte, error) {
+		return append(old, '!'), nil
+	}))
+	raw, err := ldb.db.Get([]byte("legacy"), nil)
+	require.Nil(t, err)
+	require.Equal(t, recordMagic[:], raw[:2])
+
+	// sub-second ttls are honored
+	require.Nil(t, ldb.Set("short", []byte("v"), 200*time.Millisecond))
+	require.Equal(t, int64(1), ldb.TTL("short"))
+	time.Sleep(300 * time.Millisecond)
+	_, err = ldb.Get("short")
+	require.ErrorIs(t, err, ErrNotFound)
+}
@@ -2,6 +2,8 @@ package disk
 
 import (
 	"bytes"
+	"iter"
+	"net/url"
 	"strconv"
 	"sync"
 	"time"
@@ -12,19 +14,47 @@ import (
 	"github.com/syndtr/goleveldb/leveldb/util"
 )
 
-const expSeparator = ";"
-
 // LevelDB - represents a leveldb db implementation
 type LevelDB struct {
 	db *leveldb.DB
 	sync.RWMutex
+	counters counters
+}
+
+func init() {
+	Register("leveldb", openLevelDBBackend)
 }
 
 // OpenLevelDB - Opens the specified path
 func OpenLevelDB(path string) (*LevelDB, error) {
-	db, err := leveldb.OpenFile(path, &opt.Options{
+	return openLevelDB(path, &opt.Options{
 		CompactionTableSize: 256 * Megabyte,
 	})
+}
+
+// openLevelDBBackend opens a leveldb accepting the "compaction", "cache" and "writebuffer" size params
+func openLevelDBBackend(path string, params url.Values) (DB, error) {
+	options := &opt.Options{
+		CompactionTableSize: 256 * Megabyte,
+	}
+	for param, target := range map[string]*int{
+		"compaction":  &options.CompactionTableSize,
+		"cache":       &options.BlockCacheCapacity,
+		"writebuffer": &options.WriteBuffer,
+	} {
+		if value := params.Get(param); value != "" {
+			size, err := parseSize(value)
+			if err != nil {
+				return nil, err
+			}
+			*target = int(size)
+		}
+	}
+	return openLevelDB(path, options)
+}
+
+func openLevelDB(path string, options *opt.Options) (*LevelDB, error) {
+	db, err := leveldb.OpenFile(path, options)
 	if err != nil {
 		return nil, err
 	}
@@ -60,23 +90,30 @@ func (ldb *LevelDB) GC() error {
 
 // Incr - increment the key by the specified value
 func (ldb *LevelDB) Incr(k string, by int64) (int64, error) {
+	return incr(ldb, k, by)
+}
+
+func (ldb *LevelDB) modify(k string, f modifyFunc) error {
 	ldb.Lock()
 	defer ldb.Unlock()
 
-	val, err := ldb.get(k)
+	raw, err := ldb.db.Get([]byte(k), nil)
+	switch {
+	case err == leveldb.ErrNotFound:
+		// deleted keys still in the memtable come with an empty value
+		raw = nil
+	case err != nil:
+		return err
+	}
+	old, expires, exists, err := splitRecord(raw)
 	if err != nil {
-		val = []byte{}
+		return err
 	}
-
-	valFloat, _ := strconv.ParseInt(string(val), 10, 64)
-	valFloat += by
-
-	err = ldb.set([]byte(k), intToByteSlice(valFloat), -1)
+	v, ttl, err := f(old, exists, remainingTTL(expires))
 	if err != nil {
-		return 0, err
+		return err
 	}
-
-	return valFloat, nil
+	return ldb.set([]byte(k), v, ttl)
 }
 
 func intToByteSlice(v int64) []byte {
@@ -84,71 +121,81 @@ func intToByteSlice(v int64) []byte {
 }
 
 func (ldb *LevelDB) set(k, v []byte, ttl time.Duration) error {
-	var expires int64
-	if ttl > 0 {
-		expires = time.Now().Add(ttl).Unix()
-	}
-	expiresBytes := append(intToByteSlice(expires), expSeparator[:]...)
-	v = append(expiresBytes, v...)
-	return ldb.db.Put(k, v, nil)
+	return ldb.db.Put(k, encodeRecord(v, ttl), nil)
 }
 
 // Set - sets a key with the specified value and optional ttl
 func (ldb *LevelDB) Set(k string, v []byte, ttl time.Duration) error {
+	ldb.RLock()
+	defer ldb.RUnlock()
+
 	return ldb.set([]byte(k), v, ttl)
 }
 
 // MSet - sets multiple key-value pairs
 func (ldb *LevelDB) MSet(data map[string][]byte) error {
+	ldb.RLock()
+	defer ldb.RUnlock()
+
 	batch := new(leveldb.Batch)
 	for k, v := range data {
-		v = append([]byte("0;"), v...)
-		batch.Put([]byte(k), v)
+		batch.Put([]byte(k), encodeRecord(v, 0))
 	}
 	return ldb.db.Write(batch, nil)
 }
 
-func (ldb *LevelDB) get(k string) ([]byte, error) {
-	var data []byte
-	var err error
-
-	delete := false
-
+func (ldb *LevelDB) get(k string) ([]byte, int64, error) {
 	item, err := ldb.db.Get([]byte(k), nil)
 	if err != nil {
-		return []byte{}, err
+		return []byte{}, 0, err
 	}
 
-	parts := bytes.SplitN(item, []byte(expSeparator), 2)
-	expires, actual := parts[0], parts[1]
+	data, expires, err := decodeRecord(item)
+	if err != nil {
+		return []byte{}, 0, err
+	}
 
-	if exp, _ := strconv.Atoi(string(expires)); exp > 0 && int(time.Now().Unix()) >= exp {
-		delete = true
-	} else {
-		data = actual
+	if isExpired(expires) {
+		return []byte{}, 0, errExpired
 	}
 
-	if delete {
-		errDelete := ldb.db.Delete([]byte(k), nil)
-		if errDelete != nil {
-			return data, errDelete
+	return data, expires, nil
+}
+
+// lookup fetches k, deleting it if expired
+func (ldb *LevelDB) lookup(k string) ([]byte, int64, error) {
+	v, expires, err := ldb.get(k)
+	if err == errExpired {
+		// the record is deleted under the write lock only if still expired, so that a racing
+		// SetNX claiming the key is preserved
+		if _, errDelete := ldb.deleteExpired([]string{k}); errDelete != nil {
+			return []byte{}, 0, errDelete
 		}
-		return data, ErrNotFound
+		err = ErrNotFound
 	}
-
-	return data, nil
+	return v, expires, err
 }
 
 // Get - fetches the value of the specified k
 func (ldb *LevelDB) Get(k string) ([]byte, error) {
-	return ldb.get(k)
+	v, _, err := ldb.lookup(k)
+	ldb.counters.lookup(err)
+	return v, err
+}
+
+// GetWithExpiration - fetches the value of the specified k and its expiration time, which is
+// the zero time if it doesn't expire
+func (ldb *LevelDB) GetWithExpiration(k string) ([]byte, time.Time, error) {
+	v, expires, err := ldb.lookup(k)
+	ldb.counters.lookup(err)
+	return v, expirationTime(expires), err
 }
 
 // MGet - fetch multiple values of the specified keys
 func (ldb *LevelDB) MGet(keys []string) [][]byte {
 	var data [][]byte
 	for _, key := range keys {
-		val, err := ldb.get(key)
+		val, _, err := ldb.lookup(key)
 		if err != nil {
 			data = append(data, []byte{})
 			continue
@@ -164,23 +211,40 @@ func (ldb *LevelDB) TTL(key string) int64 {
 	if err != nil {
 		return -2
 	}
+	return recordTTL(item)
+}
 
-	parts := bytes.SplitN(item, []byte(expSeparator), 2)
-	exp, _ := strconv.Atoi(string(parts[0]))
-	if exp == 0 {
-		return -1
-	}
+// WriteBatch - commits the batch atomically
+func (ldb *LevelDB) WriteBatch(b *Batch) error {
+	ldb.Lock()
+	defer ldb.Unlock()
 
-	now := time.Now().Unix()
-	if now >= int64(exp) {
-		return -2
+	batch := new(leveldb.Batch)
+	err := b.replay(
+		func(k string) ([]byte, time.Duration) {
+			v, expires, _ := ldb.get(k)
+			return v, remainingTTL(expires)
+		},
+		func(k string, v []byte, ttl time.Duration) error {
+			batch.Put([]byte(k), encodeRecord(v, ttl))
+			return nil
+		},
+		func(k string) error {
+			batch.Delete([]byte(k))
+			return nil
+		},
+	)
+	if err != nil {
+		return err
 	}
-
-	return int64(exp) - now
+	return ldb.db.Write(batch, nil)
 }
 
 // MDel - removes key(s) from the store
 func (ldb *LevelDB) MDel(keys []string) error {
+	ldb.RLock()
+	defer ldb.RUnlock()
+
 	batch := new(leveldb.Batch)
 	for _, key := range keys {
 		batch.Delete([]byte(key))
@@ -190,6 +254,9 @@ func (ldb *LevelDB) MDel(keys []string) error {
 
 // Del - removes key from the store
 func (ldb *LevelDB) Del(key string) error {
+	ldb.RLock()
+	defer ldb.RUnlock()
+
 	return ldb.db.Delete([]byte(key), nil)
 }
 
@@ -197,13 +264,17 @@ func (ldb *LevelDB) Del(key string) error {
 func (ldb *LevelDB) Scan(scannerOpt ScannerOptions) error {
 	var iter iterator.Iterator
 
-	if scannerOpt.Offset == "" {
-		iter = ldb.db.NewIterator(nil, nil)
-	} else {
-		iter = ldb.db.NewIterator(&util.Range{Start: []byte(scannerOpt.Offset)}, nil)
-		if !scannerOpt.IncludeOffset {
-			iter.Next()
+	switch {
+	case scannerOpt.Offset != "":
+		rng := &util.Range{Start: []byte(scanStart(scannerOpt))}
+		if scannerOpt.Prefix != "" {
+			rng.Limit = util.BytesPrefix([]byte(scannerOpt.Prefix)).Limit
 		}
+		iter = ldb.db.NewIterator(rng, nil)
+	case scannerOpt.Prefix != "":
+		iter = ldb.db.NewIterator(util.BytesPrefix([]byte(scannerOpt.Prefix)), nil)
+	default:
+		iter = ldb.db.NewIterator(nil, nil)
 	}
 
 	valid := func(k []byte) bool {
@@ -218,9 +289,22 @@ func (ldb *LevelDB) Scan(scannerOpt ScannerOptions) error {
 		return true
 	}
 
+	var err error
 	for iter.Next() {
 		key := iter.Key()
-		val := bytes.SplitN(iter.Value(), []byte(";"), 2)[1]
+		if skipOffset(scannerOpt, key) {
+			continue
+		}
+		var (
+			val     []byte
+			expires int64
+		)
+		if val, expires, err = decodeRecord(iter.Value()); err != nil {
+			break
+		}
+		if isExpired(expires) {
+			continue
+		}
 		if !valid(key) || scannerOpt.Handler(key, val) != nil {
 			break
 		}
@@ -228,5 +312,132 @@ func (ldb *LevelDB) Scan(scannerOpt ScannerOptions) error {
 
 	iter.Release()
 
+	if err != nil {
+		return err
+	}
 	return iter.Error()
 }
+
+// All - returns an iterator over all the items, the yielded slices are only valid until the next iteration
+func (ldb *LevelDB) All() iter.Seq2[[]byte, []byte] {
+	return ldb.Prefix("")
+}
+
+// Keys - returns an iterator over all the keys
+func (ldb *LevelDB) Keys() iter.Seq[[]byte] {
+	return keysOf(ldb.All())
+}
+
+// Prefix - returns an iterator over the items whose key starts with p
+func (ldb *LevelDB) Prefix(p string) iter.Seq2[[]byte, []byte] {
+	return func(yield func([]byte, []byte) bool) {
+		var rng *util.Range
+		if p != "" {
+			rng = util.BytesPrefix([]byte(p))
+		}
+		it := ldb.db.NewIterator(rng, nil)
+		defer it.Release()
+		for it.Next() {
+			val, expires, err := decodeRecord(it.Value())
+			// corrupted records are surfaced by Get and Scan
+			if err != nil || isExpired(expires) {
+				continue
+			}
+			if !yield(it.Key(), val) {
+				return
+			}
+		}
+	}
+}
+
+// Update - atomically replaces the value of k with the one computed by f, preserving its ttl.
+// f can return ErrAbortUpdate to leave the key untouched
+func (ldb *LevelDB) Update(k string, f func(old []byte, exists bool) ([]byte, error)) error {
+	return update(ldb, k, f)
+}
+
+// CompareAndSwap - atomically sets k to new if its current value is old
+func (ldb *LevelDB) CompareAndSwap(k string, old, new []byte) (bool, error) {
+	return compareAndSwap(ldb, k, old, new)
+}
+
+// SetNX - atomically sets k if it doesn't exist
+func (ldb *LevelDB) SetNX(k string, v []byte, ttl time.Duration) (bool, error) {
+	return setNX(ldb, k, v, ttl)
+}
+
+// GetSet - atomically sets k without expiration and returns its previous value, nil if it didn't exist
+func (ldb *LevelDB) GetSet(k string, v []byte) ([]byte, error) {
+	return getSet(ldb, k, v)
+}
+
+// SetTTL - atomically sets the ttl of k keeping its value, a non positive ttl removes the
+// expiration. It returns false if k doesn't exist
+func (ldb *LevelDB) SetTTL(k string, ttl time.Duration) (bool, error) {
+	return setTTL(ldb, k, ttl)
+}
+
+func (ldb *LevelDB) expired() iter.Seq[string] {
+	return func(yield func(string) bool) {
+		it := ldb.db.NewIterator(nil, nil)
+		defer it.Release()
+		for it.Next() {
+			if _, expires, err := decodeRecord(it.Value()); err == nil && isExpired(expires) {
+				if !yield(string(it.Key())) {
+					return
+				}
+			}
+		}
+	}
+}
+
+// deleteExpired runs under the write lock, excluding the writes racing with the sweep
+func (ldb *LevelDB) deleteExpired(keys []string) (int, error) {
+	ldb.Lock()
+	defer ldb.Unlock()
+
+	batch := new(leveldb.Batch)
+	for _, k := range keys {
+		raw, err := ldb.db.Get([]byte(k), nil)
+		if err == leveldb.ErrNotFound {
+			continue
+		}
+		if err != nil {
+			return 0, err
+		}
+		if _, expires, err := decodeRecord(raw); err == nil && isExpired(expires) {
+			batch.Delete([]byte(k))
+		}
+	}
+	if err := ldb.db.Write(batch, nil); err != nil {
+		return 0, err
+	}
+	return batch.Len(), nil
+}
+
+// Counters - returns the lookup counters and the size of the db files, without scanning
+// the records
+func (ldb *LevelDB) Counters() Stats {
+	stats := ldb.counters.stats()
+	stats.DiskBytes = ldb.Size()
+	return stats
+}
+
+// Stats - returns the statistics of the db, counting the records with a full scan
+func (ldb *LevelDB) Stats() Stats {
+	return ldb.StatsWithKeys(nil)
+}
+
+// StatsWithKeys - returns the statistics of the db, passing the key of each live record to
+// visit during the same scan. The key is only valid during the call
+func (ldb *LevelDB) StatsWithKeys(visit func(k []byte)) Stats {
+	stats := ldb.Counters()
+	it := ldb.db.NewIterator(nil, nil)
+	defer it.Release()
+	for it.Next() {
+		if v, expires, err := decodeRecord(it.Value()); err == nil {
+			stats.count(it.Key(), v, isExpired(expires), visit)
+		}
+	}
+	return stats
+}
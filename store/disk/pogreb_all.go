@@ -4,7 +4,8 @@ package disk
 
 import (
 	"bytes"
-	"strconv"
+	"iter"
+	"net/url"
 	"sync"
 	"time"
 
@@ -13,17 +14,32 @@ import (
 
 func init() {
 	OpenPogrebDB = openPogrebDB
+	Register("pogreb", openPogrebDBBackend)
 }
 
 // PogrebDB - represents a pogreb db implementation
 type PogrebDB struct {
 	db *pogreb.DB
 	sync.RWMutex
+	counters counters
 }
 
 // OpenPogrebDB - Opens the specified path
 func openPogrebDB(path string) (DB, error) {
-	db, err := pogreb.Open(path, nil)
+	return openPogrebDBBackend(path, nil)
+}
+
+// openPogrebDBBackend opens a pogreb db accepting the background "sync" interval param
+func openPogrebDBBackend(path string, params url.Values) (DB, error) {
+	options := &pogreb.Options{}
+	if value := params.Get("sync"); value != "" {
+		interval, err := time.ParseDuration(value)
+		if err != nil {
+			return nil, err
+		}
+		options.BackgroundSyncInterval = interval
+	}
+	db, err := pogreb.Open(path, options)
 	if err != nil {
 		return nil, err
 	}
@@ -56,88 +72,143 @@ func (pdb *PogrebDB) GC() error {
 
 // Incr - increment the key by the specified value
 func (pdb *PogrebDB) Incr(k string, by int64) (int64, error) {
+	return incr(pdb, k, by)
+}
+
+func (pdb *PogrebDB) modify(k string, f modifyFunc) error {
 	pdb.Lock()
 	defer pdb.Unlock()
 
-	val, err := pdb.get(k)
+	raw, err := pdb.db.Get([]byte(k))
 	if err != nil {
-		val = []byte{}
+		return err
 	}
-
-	valFloat, _ := strconv.ParseInt(string(val), 10, 64)
-	valFloat += by
-
-	err = pdb.set([]byte(k), intToByteSlice(valFloat), -1)
+	old, expires, exists, err := splitRecord(raw)
 	if err != nil {
-		return 0, err
+		return err
 	}
-
-	return valFloat, nil
+	v, ttl, err := f(old, exists, remainingTTL(expires))
+	if err != nil {
+		return err
+	}
+	return pdb.set([]byte(k), v, ttl)
 }
 
 func (pdb *PogrebDB) set(k, v []byte, ttl time.Duration) error {
-	var expires int64
-	if ttl > 0 {
-		expires = time.Now().Add(ttl).Unix()
-	}
-	expiresBytes := append(intToByteSlice(expires), expSeparator[:]...)
-	v = append(expiresBytes, v...)
-	return pdb.db.Put(k, v)
+	return pdb.db.Put(k, encodeRecord(v, ttl))
 }
 
 // Set - sets a key with the specified value and optional ttl
 func (pdb *PogrebDB) Set(k string, v []byte, ttl time.Duration) error {
+	pdb.RLock()
+	defer pdb.RUnlock()
+
 	return pdb.set([]byte(k), v, ttl)
 }
 
 // MSet - sets multiple key-value pairs
 func (pdb *PogrebDB) MSet(data map[string][]byte) error {
-	return nil
+	b := NewBatch()
+	for k, v := range data {
+		b.Put(k, v, 0)
+	}
+	return pdb.WriteBatch(b)
 }
 
-func (pdb *PogrebDB) get(k string) ([]byte, error) {
-	var data []byte
-	var err error
+// WriteBatch - applies the batch under the db lock, restoring the previous values on failure
+func (pdb *PogrebDB) WriteBatch(b *Batch) error {
+	pdb.Lock()
+	defer pdb.Unlock()
 
-	delete := false
+	// save the raw records to restore them on failure
+	previous := make(map[string][]byte)
+	for _, k := range b.keys() {
+		v, err := pdb.db.Get([]byte(k))
+		if err != nil {
+			return err
+		}
+		previous[k] = v
+	}
 
+	err := b.replay(
+		func(k string) ([]byte, time.Duration) {
+			v, expires, _ := pdb.get(k)
+			return v, remainingTTL(expires)
+		},
+		func(k string, v []byte, ttl time.Duration) error {
+			return pdb.set([]byte(k), v, ttl)
+		},
+		func(k string) error {
+			return pdb.db.Delete([]byte(k))
+		},
+	)
+	if err != nil {
+		for k, v := range previous {
+			if v == nil {
+				_ = pdb.db.Delete([]byte(k))
+			} else {
+				_ = pdb.db.Put([]byte(k), v)
+			}
+		}
+	}
+	return err
+}
+
+func (pdb *PogrebDB) get(k string) ([]byte, int64, error) {
 	item, err := pdb.db.Get([]byte(k))
 	if err != nil {
-		return []byte{}, err
+		return []byte{}, 0, err
 	}
 
 	if len(item) == 0 {
-		return []byte{}, ErrNotFound
+		return []byte{}, 0, ErrNotFound
 	}
 
-	parts := bytes.SplitN(item, []byte(expSeparator), 2)
-	expires, actual := parts[0], parts[1]
+	data, expires, err := decodeRecord(item)
+	if err != nil {
+		return []byte{}, 0, err
+	}
 
-	if exp, _ := strconv.Atoi(string(expires)); exp > 0 && int(time.Now().Unix()) >= exp {
-		delete = true
+	if isExpired(expires) {
+		return []byte{}, 0, errExpired
 	}
-	data = actual
+	return data, expires, nil
+}
 
-	if delete {
-		errDelete := pdb.db.Delete([]byte(k))
-		if errDelete != nil {
-			return data, errDelete
+// lookup fetches k, deleting it if expired
+func (pdb *PogrebDB) lookup(k string) ([]byte, int64, error) {
+	v, expires, err := pdb.get(k)
+	if err == errExpired {
+		// the record is deleted under the write lock only if still expired, so that a racing
+		// SetNX claiming the key is preserved
+		if _, errDelete := pdb.deleteExpired([]string{k}); errDelete != nil {
+			return []byte{}, 0, errDelete
 		}
-		return data, ErrNotFound
+		err = ErrNotFound
 	}
-	return data, nil
+	return v, expires, err
 }
 
 // Get - fetches the value of the specified k
 func (pdb *PogrebDB) Get(k string) ([]byte, error) {
-	return pdb.get(k)
+	v, _, err := pdb.lookup(k)
+	pdb.counters.lookup(err)
+	return v, err
+}
+
+// GetWithExpiration - fetches the value of the specified k and its expiration time, which is
+// the zero time if it doesn't expire
+func (pdb *PogrebDB) GetWithExpiration(k string) ([]byte, time.Time, error) {
+	v, expires, err := pdb.lookup(k)
+	pdb.counters.lookup(err)
+	return v, expirationTime(expires), err
 }
 
 // MGet - fetch multiple values of the specified keys
 func (pdb *PogrebDB) MGet(keys []string) [][]byte {
 	var data [][]byte
 	for _, key := range keys {
-		val, err := pdb.get(key)
+		val, _, err := pdb.lookup(key)
 		if err != nil {
 			data = append(data, []byte{})
 			continue
@@ -153,28 +224,23 @@ func (pdb *PogrebDB) TTL(key string) int64 {
 	if err != nil {
 		return -2
 	}
-
-	parts := bytes.SplitN(item, []byte(expSeparator), 2)
-	exp, _ := strconv.Atoi(string(parts[0]))
-	if exp == 0 {
-		return -1
-	}
-
-	now := time.Now().Unix()
-	if now >= int64(exp) {
-		return -2
-	}
-
-	return int64(exp) - now
+	return recordTTL(item)
 }
 
 // MDel - removes key(s) from the store
 func (pdb *PogrebDB) MDel(keys []string) error {
-	return nil
+	b := NewBatch()
+	for _, k := range keys {
+		b.Delete(k)
+	}
+	return pdb.WriteBatch(b)
 }
 
 // Del - removes key from the store
 func (pdb *PogrebDB) Del(key string) error {
+	pdb.RLock()
+	defer pdb.RUnlock()
+
 	return pdb.db.Delete([]byte(key))
 }
 
@@ -201,12 +267,153 @@ func (pdb *PogrebDB) Scan(scannerOpt ScannerOptions) error {
 		if err != nil {
 			return err
 		}
-		parts := bytes.SplitN(val, []byte(expSeparator), 2)
-		_, data := parts[0], parts[1]
-		if !valid(key) || scannerOpt.Handler(key, data) != nil {
+		// items are not sorted, so filter on prefix and offset without stopping
+		if !valid(key) || skipOffset(scannerOpt, key) || (scannerOpt.Offset != "" && string(key) < scannerOpt.Offset) {
+			continue
+		}
+		data, expires, err := decodeRecord(val)
+		if err != nil {
+			return err
+		}
+		if isExpired(expires) {
+			continue
+		}
+		if scannerOpt.Handler(key, data) != nil {
 			break
 		}
 	}
 
 	return nil
 }
+
+// All - returns an iterator over all the items
+func (pdb *PogrebDB) All() iter.Seq2[[]byte, []byte] {
+	return pdb.Prefix("")
+}
+
+// Keys - returns an iterator over all the keys
+func (pdb *PogrebDB) Keys() iter.Seq[[]byte] {
+	return keysOf(pdb.All())
+}
+
+// Prefix - returns an iterator over the items whose key starts with p, in no particular order
+func (pdb *PogrebDB) Prefix(p string) iter.Seq2[[]byte, []byte] {
+	return func(yield func([]byte, []byte) bool) {
+		it := pdb.db.Items()
+		for {
+			key, val, err := it.Next()
+			if err != nil {
+				return
+			}
+			if !bytes.HasPrefix(key, []byte(p)) {
+				continue
+			}
+			data, expires, err := decodeRecord(val)
+			// corrupted records are surfaced by Get and Scan
+			if err != nil || isExpired(expires) {
+				continue
+			}
+			if !yield(key, data) {
+				return
+			}
+		}
+	}
+}
+
+// Update - atomically replaces the value of k with the one computed by f, preserving its ttl.
+// f can return ErrAbortUpdate to leave the key untouched
+func (pdb *PogrebDB) Update(k string, f func(old []byte, exists bool) ([]byte, error)) error {
+	return update(pdb, k, f)
+}
+
+// CompareAndSwap - atomically sets k to new if its current value is old
+func (pdb *PogrebDB) CompareAndSwap(k string, old, new []byte) (bool, error) {
+	return compareAndSwap(pdb, k, old, new)
+}
+
+// SetNX - atomically sets k if it doesn't exist
+func (pdb *PogrebDB) SetNX(k string, v []byte, ttl time.Duration) (bool, error) {
+	return setNX(pdb, k, v, ttl)
+}
+
+// GetSet - atomically sets k without expiration and returns its previous value, nil if it didn't exist
+func (pdb *PogrebDB) GetSet(k string, v []byte) ([]byte, error) {
+	return getSet(pdb, k, v)
+}
+
+// SetTTL - atomically sets the ttl of k keeping its value, a non positive ttl removes the
+// expiration. It returns false if k doesn't exist
+func (pdb *PogrebDB) SetTTL(k string, ttl time.Duration) (bool, error) {
+	return setTTL(pdb, k, ttl)
+}
+
+func (pdb *PogrebDB) expired() iter.Seq[string] {
+	return func(yield func(string) bool) {
+		it := pdb.db.Items()
+		for {
+			key, val, err := it.Next()
+			if err != nil {
+				return
+			}
+			if _, expires, err := decodeRecord(val); err == nil && isExpired(expires) {
+				if !yield(string(key)) {
+					return
+				}
+			}
+		}
+	}
+}
+
+// deleteExpired runs under the write lock, excluding the writes racing with the sweep
+func (pdb *PogrebDB) deleteExpired(keys []string) (int, error) {
+	pdb.Lock()
+	defer pdb.Unlock()
+
+	deleted := 0
+	for _, k := range keys {
+		raw, err := pdb.db.Get([]byte(k))
+		if err != nil {
+			return deleted, err
+		}
+		if raw == nil {
+			continue
+		}
+		if _, expires, err := decodeRecord(raw); err == nil && isExpired(expires) {
+			if err := pdb.db.Delete([]byte(k)); err != nil {
+				return deleted, err
+			}
+			deleted++
+		}
+	}
+	return deleted, nil
+}
+
+// Counters - returns the lookup counters and the size of the db files, without scanning
+// the records
+func (pdb *PogrebDB) Counters() Stats {
+	stats := pdb.counters.stats()
+	stats.DiskBytes = pdb.Size()
+	return stats
+}
+
+// Stats - returns the statistics of the db, counting the records with a full scan
+func (pdb *PogrebDB) Stats() Stats {
+	return pdb.StatsWithKeys(nil)
+}
+
+// StatsWithKeys - returns the statistics of the db, passing the key of each live record to
+// visit during the same scan. The key is only valid during the call
+func (pdb *PogrebDB) StatsWithKeys(visit func(k []byte)) Stats {
+	stats := pdb.Counters()
+	it := pdb.db.Items()
+	for {
+		key, val, err := it.Next()
+		if err != nil {
+			break
+		}
+		if v, expires, err := decodeRecord(val); err == nil {
+			stats.count(key, v, isExpired(expires), visit)
+		}
+	}
+	return stats
+}
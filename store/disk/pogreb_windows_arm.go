@@ -2,8 +2,13 @@
 
 package disk
 
+import "net/url"
+
 func init() {
 	OpenPogrebDB = func(_ string) (DB, error) {
 		return nil, ErrNotSupported
 	}
+	Register("pogreb", func(_ string, _ url.Values) (DB, error) {
+		return nil, ErrNotSupported
+	})
 }
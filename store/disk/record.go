@@ -0,0 +1,147 @@
+package disk
+
+import (
+	"bytes"
+	"encoding/binary"
+	"hash/crc32"
+	"strconv"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// The LevelDB, Pogreb and BBolt stores wrap each value in a fixed size header:
+//
+//	magic (2) | version (1) | flags (1) | expiration in unix nanoseconds (8) | crc32 (4)
+//
+// The checksum covers the preceding header fields and the value. Records written by previous
+// releases as "<unix-seconds>;<value>" are read transparently and upgraded on their next write
+const (
+	recordVersion    = 1
+	recordHeaderSize = 16
+
+	// recordFlagExpires marks records with an expiration
+	recordFlagExpires = 1 << 0
+
+	legacySeparator = ';'
+)
+
+var (
+	// recordMagic can't start a legacy record, which always begins with a decimal number
+	recordMagic = [2]byte{0xfe, 'h'}
+	crcTable    = crc32.MakeTable(crc32.Castagnoli)
+)
+
+// encodeRecord wraps v in a record expiring after ttl, a non positive ttl means no expiration
+func encodeRecord(v []byte, ttl time.Duration) []byte {
+	record := make([]byte, recordHeaderSize+len(v))
+	copy(record, recordMagic[:])
+	record[2] = recordVersion
+	if ttl > 0 {
+		record[3] = recordFlagExpires
+		binary.BigEndian.PutUint64(record[4:12], uint64(time.Now().Add(ttl).UnixNano()))
+	}
+	copy(record[recordHeaderSize:], v)
+	crc := crc32.Update(crc32.Checksum(record[:12], crcTable), crcTable, v)
+	binary.BigEndian.PutUint32(record[12:16], crc)
+	return record
+}
+
+// decodeRecord returns the value and the expiration (unix nanoseconds, 0 if none) of a raw
+// record. The value shares the memory of raw
+func decodeRecord(raw []byte) ([]byte, int64, error) {
+	if len(raw) < 2 || raw[0] != recordMagic[0] || raw[1] != recordMagic[1] {
+		return decodeLegacyRecord(raw)
+	}
+	if len(raw) < recordHeaderSize {
+		return nil, 0, errors.Wrap(ErrCorruptedRecord, "truncated header")
+	}
+	if raw[2] != recordVersion {
+		return nil, 0, errors.Wrapf(ErrCorruptedRecord, "unknown version %d", raw[2])
+	}
+	v := raw[recordHeaderSize:]
+	crc := crc32.Update(crc32.Checksum(raw[:12], crcTable), crcTable, v)
+	if crc != binary.BigEndian.Uint32(raw[12:16]) {
+		return nil, 0, errors.Wrap(ErrCorruptedRecord, "checksum mismatch")
+	}
+	var expires int64
+	if raw[3]&recordFlagExpires != 0 {
+		expires = int64(binary.BigEndian.Uint64(raw[4:12]))
+	}
+	return v, expires, nil
+}
+
+// decodeLegacyRecord parses the "<unix-seconds>;<value>" format
+func decodeLegacyRecord(raw []byte) ([]byte, int64, error) {
+	sep := bytes.IndexByte(raw, legacySeparator)
+	if sep < 0 {
+		return nil, 0, errors.Wrap(ErrCorruptedRecord, "missing expiration separator")
+	}
+	seconds, err := strconv.ParseInt(string(raw[:sep]), 10, 64)
+	if err != nil {
+		return nil, 0, errors.Wrap(ErrCorruptedRecord, "invalid expiration")
+	}
+	var expires int64
+	if seconds > 0 {
+		expires = time.Unix(seconds, 0).UnixNano()
+	}
+	return raw[sep+1:], expires, nil
+}
+
+// isExpired returns true if the expiration (unix nanoseconds, 0 if none) has passed
+func isExpired(expires int64) bool {
+	return expires > 0 && time.Now().UnixNano() >= expires
+}
+
+// splitRecord returns the value and the expiration of a raw record, exists is false if it's
+// missing or expired
+func splitRecord(raw []byte) ([]byte, int64, bool, error) {
+	if raw == nil {
+		return nil, 0, false, nil
+	}
+	v, expires, err := decodeRecord(raw)
+	if err != nil {
+		return nil, 0, false, err
+	}
+	if isExpired(expires) {
+		return nil, 0, false, nil
+	}
+	return v, expires, true, nil
+}
+
+// remainingTTL converts an expiration in unix nanoseconds to a ttl, zero if it doesn't expire
+func remainingTTL(expires int64) time.Duration {
+	if expires == 0 {
+		return 0
+	}
+	return time.Until(time.Unix(0, expires))
+}
+
+// expirationTime converts an expiration in unix nanoseconds to a time, the zero time if it
+// doesn't expire
+func expirationTime(expires int64) time.Time {
+	if expires == 0 {
+		return time.Time{}
+	}
+	return time.Unix(0, expires)
+}
+
+// recordTTL returns the seconds left before a raw record expires, rounded up, -1 if it doesn't
+// expire and -2 if it's missing, expired or corrupted
+func recordTTL(raw []byte) int64 {
+	if raw == nil {
+		return -2
+	}
+	_, expires, err := decodeRecord(raw)
+	if err != nil {
+		return -2
+	}
+	if expires == 0 {
+		return -1
+	}
+	left := remainingTTL(expires)
+	if left <= 0 {
+		return -2
+	}
+	return int64((left + time.Second - 1) / time.Second)
+}
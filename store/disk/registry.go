@@ -0,0 +1,108 @@
+package disk
+
+import (
+	"net/url"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/pkg/errors"
+)
+
+// OpenFunc opens a backend at path with backend specific parameters
+type OpenFunc func(path string, params url.Values) (DB, error)
+
+var (
+	registryMu sync.RWMutex
+	registry   = make(map[string]OpenFunc)
+)
+
+// Register makes a backend available by name to Open and OpenBackend.
+// It panics if open is nil or the name is already registered
+func Register(name string, open OpenFunc) {
+	registryMu.Lock()
+	defer registryMu.Unlock()
+	if open == nil {
+		panic("disk: Register open func is nil")
+	}
+	if _, dup := registry[name]; dup {
+		panic("disk: Register called twice for backend " + name)
+	}
+	registry[name] = open
+}
+
+// Backends returns the sorted names of the registered backends
+func Backends() []string {
+	registryMu.RLock()
+	defer registryMu.RUnlock()
+	names := make([]string, 0, len(registry))
+	for name := range registry {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// OpenBackend opens the registered backend name at path
+func OpenBackend(name, path string, params url.Values) (DB, error) {
+	registryMu.RLock()
+	open, ok := registry[name]
+	registryMu.RUnlock()
+	if !ok {
+		return nil, errors.Wrapf(ErrNotSupported, "unknown backend %q", name)
+	}
+	if params == nil {
+		params = url.Values{}
+	}
+	return open(path, params)
+}
+
+// Open opens a backend from a dsn in the form "<backend>://<path>?<params>", for example
+// "leveldb:///tmp/db?compaction=256MB" or "bbolt://./data/db?bucket=hosts"
+func Open(dsn string) (DB, error) {
+	u, err := url.Parse(dsn)
+	if err != nil {
+		return nil, err
+	}
+	if u.Scheme == "" {
+		return nil, errors.Errorf("missing backend in dsn %q", dsn)
+	}
+	path := u.Opaque
+	if path == "" {
+		path = u.Host + u.Path
+	}
+	if path == "" {
+		return nil, errors.Errorf("missing path in dsn %q", dsn)
+	}
+	return OpenBackend(u.Scheme, filepath.FromSlash(path), u.Query())
+}
+
+var sizeUnits = []struct {
+	suffix string
+	size   int64
+}{
+	{"GB", 1 << 30},
+	{"MB", Megabyte},
+	{"KB", 1 << 10},
+	{"B", 1},
+}
+
+// parseSize parses sizes as "256MB", "64KB" or "1024"
+func parseSize(s string) (int64, error) {
+	value := strings.ToUpper(strings.TrimSpace(s))
+	multiplier := int64(1)
+	for _, unit := range sizeUnits {
+		if strings.HasSuffix(value, unit.suffix) {
+			value = strings.TrimSpace(strings.TrimSuffix(value, unit.suffix))
+			multiplier = unit.size
+			break
+		}
+	}
+	n, err := strconv.ParseInt(value, 10, 64)
+	if err != nil {
+		return 0, errors.Wrapf(err, "invalid size %q", s)
+	}
+	return n * multiplier, nil
+}
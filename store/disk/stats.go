@@ -0,0 +1,54 @@
+package disk
+
+import "sync/atomic"
+
+// Stats - represents the statistics of a db
+type Stats struct {
+	// Items is the number of live records
+	Items int64
+	// Bytes is the size of the keys and values of the live records
+	Bytes int64
+	// DiskBytes is the size of the db files, as returned by Size
+	DiskBytes int64
+	// Expired is the number of expired records not deleted yet
+	Expired int64
+	// Hits and Misses count the Get lookups
+	Hits   uint64
+	Misses uint64
+}
+
+// counters tracks the lookups of a db
+type counters struct {
+	hits   atomic.Uint64
+	misses atomic.Uint64
+}
+
+// lookup accounts for a Get returning err
+func (c *counters) lookup(err error) {
+	if err == nil {
+		c.hits.Add(1)
+	} else {
+		c.misses.Add(1)
+	}
+}
+
+// stats returns the stats holding the counters
+func (c *counters) stats() Stats {
+	return Stats{
+		Hits:   c.hits.Load(),
+		Misses: c.misses.Load(),
+	}
+}
+
+// count accounts for a record, passing the key of a live one to visit if not nil
+func (s *Stats) count(k, v []byte, expired bool, visit func(k []byte)) {
+	if expired {
+		s.Expired++
+		return
+	}
+	s.Items++
+	s.Bytes += int64(len(k) + len(v))
+	if visit != nil {
+		visit(k)
+	}
+}
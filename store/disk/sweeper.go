@@ -0,0 +1,172 @@
+package disk
+
+import (
+	"iter"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// sweepable is implemented by the backends storing the expiration within the records,
+// BuntDB expires its records on its own
+type sweepable interface {
+	// expired returns an iterator over the keys of the expired records, keys can be
+	// deleted while iterating
+	expired() iter.Seq[string]
+	// deleteExpired deletes the keys whose record is still expired, returning how many
+	deleteExpired(keys []string) (int, error)
+}
+
+// Wrapper - implemented by the dbs wrapping another one, such as the instrumented dbs of the
+// metrics package, so that the sweeper can reach the wrapped backend
+type Wrapper interface {
+	Unwrap() DB
+}
+
+// asSweepable returns the sweepable backend of db, unwrapping it if needed
+func asSweepable(db DB) (sweepable, bool) {
+	for {
+		if s, ok := db.(sweepable); ok {
+			return s, true
+		}
+		w, ok := db.(Wrapper)
+		if !ok {
+			return nil, false
+		}
+		db = w.Unwrap()
+	}
+}
+
+// SweeperOptions - represents the options of an expiry sweeper
+type SweeperOptions struct {
+	// Interval between two sweeps
+	Interval time.Duration
+	// BatchSize is the max number of expired keys deleted at once
+	BatchSize int
+	// Rate is the max number of expired keys deleted per second, 0 means unlimited
+	Rate int
+	// OnSweep is called after every background sweep with the number of reclaimed keys
+	OnSweep func(reclaimed int, err error)
+}
+
+// DefaultSweeperOptions - sweeps every minute in batches of 1000 keys
+var DefaultSweeperOptions = SweeperOptions{
+	Interval:  time.Minute,
+	BatchSize: 1000,
+}
+
+// Sweeper - periodically deletes the expired records of a db, which otherwise are only
+// removed when Get touches them
+type Sweeper struct {
+	db        sweepable
+	options   SweeperOptions
+	reclaimed atomic.Int64
+	stop      chan struct{}
+	done      chan struct{}
+	stopOnce  sync.Once
+}
+
+// NewSweeper starts sweeping db in background, it fails with ErrNotSupported on backends
+// not storing the expiration within the records. Wrapped dbs are unwrapped through Wrapper
+func NewSweeper(db DB, options SweeperOptions) (*Sweeper, error) {
+	backend, ok := asSweepable(db)
+	if !ok {
+		return nil, ErrNotSupported
+	}
+	if options.Interval <= 0 {
+		options.Interval = DefaultSweeperOptions.Interval
+	}
+	if options.BatchSize <= 0 {
+		options.BatchSize = DefaultSweeperOptions.BatchSize
+	}
+	s := &Sweeper{
+		db:      backend,
+		options: options,
+		stop:    make(chan struct{}),
+		done:    make(chan struct{}),
+	}
+	go s.run()
+	return s, nil
+}
+
+func (s *Sweeper) run() {
+	defer close(s.done)
+	ticker := time.NewTicker(s.options.Interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-s.stop:
+			return
+		case <-ticker.C:
+			reclaimed, err := s.Sweep()
+			if s.options.OnSweep != nil {
+				s.options.OnSweep(reclaimed, err)
+			}
+		}
+	}
+}
+
+// Sweep - deletes the expired records right away, returning how many were reclaimed
+func (s *Sweeper) Sweep() (int, error) {
+	db := s.db
+	var (
+		reclaimed int
+		batch     []string
+	)
+	flush := func() error {
+		start := time.Now()
+		n, err := db.deleteExpired(batch)
+		reclaimed += n
+		s.reclaimed.Add(int64(n))
+		batch = batch[:0]
+		if err != nil {
+			return err
+		}
+		if s.options.Rate > 0 {
+			wait := time.Duration(n)*time.Second/time.Duration(s.options.Rate) - time.Since(start)
+			select {
+			case <-s.stop:
+			case <-time.After(wait):
+			}
+		}
+		return nil
+	}
+	for k := range db.expired() {
+		batch = append(batch, k)
+		if len(batch) < s.options.BatchSize {
+			continue
+		}
+		if err := flush(); err != nil {
+			return reclaimed, err
+		}
+		if s.stopped() {
+			return reclaimed, nil
+		}
+	}
+	if len(batch) > 0 {
+		return reclaimed, flush()
+	}
+	return reclaimed, nil
+}
+
+// Reclaimed - returns the number of expired keys deleted since the sweeper started
+func (s *Sweeper) Reclaimed() int64 {
+	return s.reclaimed.Load()
+}
+
+// Stop - stops the background sweeps, waiting for a running one to end
+func (s *Sweeper) Stop() {
+	s.stopOnce.Do(func() {
+		close(s.stop)
+	})
+	<-s.done
+}
+
+func (s *Sweeper) stopped() bool {
+	select {
+	case <-s.stop:
+		return true
+	default:
+		return false
+	}
+}
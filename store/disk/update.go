@@ -0,0 +1,96 @@
+package disk
+
+import (
+	"bytes"
+	"strconv"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// modifyFunc computes the new value and ttl of a key from its current live value and
+// remaining ttl (zero if it doesn't expire). Returning ErrAbortUpdate leaves the key untouched
+type modifyFunc func(old []byte, exists bool, ttl time.Duration) ([]byte, time.Duration, error)
+
+// modifier is implemented by every backend to run a read-modify-write cycle atomically
+// with respect to the other read-modify-write operations on the same db
+type modifier interface {
+	modify(k string, f modifyFunc) error
+}
+
+func update(m modifier, k string, f func(old []byte, exists bool) ([]byte, error)) error {
+	err := m.modify(k, func(old []byte, exists bool, ttl time.Duration) ([]byte, time.Duration, error) {
+		v, err := f(old, exists)
+		return v, ttl, err
+	})
+	if errors.Is(err, ErrAbortUpdate) {
+		return nil
+	}
+	return err
+}
+
+func compareAndSwap(m modifier, k string, old, new []byte) (bool, error) {
+	var swapped bool
+	err := m.modify(k, func(current []byte, exists bool, ttl time.Duration) ([]byte, time.Duration, error) {
+		if !exists || !bytes.Equal(current, old) {
+			return nil, 0, ErrAbortUpdate
+		}
+		swapped = true
+		return new, ttl, nil
+	})
+	if errors.Is(err, ErrAbortUpdate) {
+		err = nil
+	}
+	return swapped, err
+}
+
+func setNX(m modifier, k string, v []byte, ttl time.Duration) (bool, error) {
+	var set bool
+	err := m.modify(k, func(_ []byte, exists bool, _ time.Duration) ([]byte, time.Duration, error) {
+		if exists {
+			return nil, 0, ErrAbortUpdate
+		}
+		set = true
+		return v, ttl, nil
+	})
+	if errors.Is(err, ErrAbortUpdate) {
+		err = nil
+	}
+	return set, err
+}
+
+func getSet(m modifier, k string, v []byte) ([]byte, error) {
+	var previous []byte
+	err := m.modify(k, func(old []byte, exists bool, _ time.Duration) ([]byte, time.Duration, error) {
+		if exists {
+			previous = bytes.Clone(old)
+		}
+		return v, 0, nil
+	})
+	return previous, err
+}
+
+func incr(m modifier, k string, by int64) (int64, error) {
+	var n int64
+	err := m.modify(k, func(old []byte, _ bool, ttl time.Duration) ([]byte, time.Duration, error) {
+		n, _ = strconv.ParseInt(string(old), 10, 64)
+		n += by
+		return intToByteSlice(n), ttl, nil
+	})
+	return n, err
+}
+
+func setTTL(m modifier, k string, ttl time.Duration) (bool, error) {
+	var found bool
+	err := m.modify(k, func(old []byte, exists bool, _ time.Duration) ([]byte, time.Duration, error) {
+		if !exists {
+			return nil, 0, ErrAbortUpdate
+		}
+		found = true
+		return old, ttl, nil
+	})
+	if errors.Is(err, ErrAbortUpdate) {
+		err = nil
+	}
+	return found, err
+}
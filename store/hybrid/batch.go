@@ -0,0 +1,49 @@
+package hybrid
+
+import (
+	"strconv"
+
+	"github.com/projectdiscovery/hmap/store/disk"
+)
+
+// WriteBatch - commits the batch to the disk store with the atomicity guarantees of its backend.
+// In Hybrid mode the memory copies of the touched keys are moved to disk first, so that the
+// batch sees and replaces them. In Memory mode the operations are applied in order without
+// isolation from concurrent writers
+func (hm *HybridMap) WriteBatch(b *disk.Batch) error {
+	defer hm.track(OpBatch)()
+
+	switch hm.options.Type {
+	case Memory:
+		for _, op := range b.Ops() {
+			switch op.Type {
+			case disk.BatchPut:
+				if err := hm.SetWithTTL(op.Key, op.Value, op.TTL); err != nil {
+					return err
+				}
+			case disk.BatchDelete:
+				hm.memorymap.Delete(op.Key)
+			case disk.BatchIncr:
+				var n int64
+				if v, _, ok := hm.memorymap.Peek(op.Key); ok {
+					if vb, ok := v.([]byte); ok {
+						n, _ = strconv.ParseInt(string(vb), 10, 64)
+					}
+				}
+				hm.memorymap.Set(op.Key, []byte(strconv.FormatInt(n+op.By, 10)))
+			}
+		}
+		return nil
+	case Hybrid:
+		for _, op := range b.Ops() {
+			if v, _, ok := hm.memorymap.Peek(op.Key); ok {
+				hm.memorymap.Delete(op.Key)
+				hm.spill(op.Key, v.([]byte))
+			}
+		}
+		fallthrough
+	case Disk:
+		return hm.diskmap.WriteBatch(b)
+	}
+	return nil
+}
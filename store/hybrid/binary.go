@@ -0,0 +1,543 @@
+package hybrid
+
+import (
+	"bytes"
+	"encoding"
+	"encoding/binary"
+	"math"
+	"reflect"
+	"sort"
+
+	"github.com/pkg/errors"
+)
+
+// The BinaryCodec encoding is self-describing: each value starts with a tag byte followed by
+// its payload
+//
+//	nil | false | true
+//	int (varint) | uint (uvarint) | float (IEEE 754, 8 bytes big endian)
+//	string | bytes | binary (uvarint length, data)
+//	list (uvarint count, items) | map (uvarint count, key and value pairs)
+//
+// binary holds the output of encoding.BinaryMarshaler. Structs are encoded as maps keyed by
+// the names of their exported fields, so fields can be added or removed without breaking the
+// stored values, and map entries are sorted by encoded key to keep the encoding deterministic
+const (
+	tagNil byte = iota
+	tagFalse
+	tagTrue
+	tagInt
+	tagUint
+	tagFloat
+	tagString
+	tagBytes
+	tagBinary
+	tagList
+	tagMap
+)
+
+var (
+	binaryMarshalerType   = reflect.TypeFor[encoding.BinaryMarshaler]()
+	binaryUnmarshalerType = reflect.TypeFor[encoding.BinaryUnmarshaler]()
+)
+
+func appendData(buf []byte, tag byte, data []byte) []byte {
+	buf = binary.AppendUvarint(append(buf, tag), uint64(len(data)))
+	return append(buf, data...)
+}
+
+// appendValue appends the encoding of v to buf
+func appendValue(buf []byte, v reflect.Value) ([]byte, error) {
+	if !v.IsValid() {
+		return append(buf, tagNil), nil
+	}
+	if m, ok := binaryMarshaler(v); ok {
+		data, err := m.MarshalBinary()
+		if err != nil {
+			return nil, err
+		}
+		return appendData(buf, tagBinary, data), nil
+	}
+	switch v.Kind() {
+	case reflect.Bool:
+		if v.Bool() {
+			return append(buf, tagTrue), nil
+		}
+		return append(buf, tagFalse), nil
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return binary.AppendVarint(append(buf, tagInt), v.Int()), nil
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		return binary.AppendUvarint(append(buf, tagUint), v.Uint()), nil
+	case reflect.Float32, reflect.Float64:
+		return binary.BigEndian.AppendUint64(append(buf, tagFloat), math.Float64bits(v.Float())), nil
+	case reflect.String:
+		buf = binary.AppendUvarint(append(buf, tagString), uint64(v.Len()))
+		return append(buf, v.String()...), nil
+	case reflect.Slice:
+		if v.IsNil() {
+			return append(buf, tagNil), nil
+		}
+		if v.Type().Elem().Kind() == reflect.Uint8 {
+			return appendData(buf, tagBytes, v.Bytes()), nil
+		}
+		return appendList(buf, v)
+	case reflect.Array:
+		return appendList(buf, v)
+	case reflect.Map:
+		if v.IsNil() {
+			return append(buf, tagNil), nil
+		}
+		return appendMap(buf, v)
+	case reflect.Struct:
+		return appendStruct(buf, v)
+	case reflect.Pointer, reflect.Interface:
+		if v.IsNil() {
+			return append(buf, tagNil), nil
+		}
+		return appendValue(buf, v.Elem())
+	}
+	return nil, errors.Wrapf(ErrUnsupportedType, "binary codec: %s", v.Type())
+}
+
+// binaryMarshaler returns the encoding.BinaryMarshaler implemented by v or by its pointer
+func binaryMarshaler(v reflect.Value) (encoding.BinaryMarshaler, bool) {
+	t := v.Type()
+	switch {
+	case t.Implements(binaryMarshalerType):
+		if (v.Kind() == reflect.Pointer || v.Kind() == reflect.Interface) && v.IsNil() {
+			return nil, false
+		}
+		return v.Interface().(encoding.BinaryMarshaler), true
+	case v.Kind() != reflect.Pointer && reflect.PointerTo(t).Implements(binaryMarshalerType):
+		p := reflect.New(t)
+		p.Elem().Set(v)
+		return p.Interface().(encoding.BinaryMarshaler), true
+	}
+	return nil, false
+}
+
+func appendList(buf []byte, v reflect.Value) ([]byte, error) {
+	buf = binary.AppendUvarint(append(buf, tagList), uint64(v.Len()))
+	var err error
+	for i := 0; i < v.Len(); i++ {
+		if buf, err = appendValue(buf, v.Index(i)); err != nil {
+			return nil, err
+		}
+	}
+	return buf, nil
+}
+
+func appendMap(buf []byte, v reflect.Value) ([]byte, error) {
+	type entry struct {
+		k, v []byte
+	}
+	entries := make([]entry, 0, v.Len())
+	it := v.MapRange()
+	for it.Next() {
+		k, err := appendValue(nil, it.Key())
+		if err != nil {
+			return nil, err
+		}
+		e, err := appendValue(nil, it.Value())
+		if err != nil {
+			return nil, err
+		}
+		entries = append(entries, entry{k: k, v: e})
+	}
+	sort.Slice(entries, func(i, j int) bool {
+		return bytes.Compare(entries[i].k, entries[j].k) < 0
+	})
+	buf = binary.AppendUvarint(append(buf, tagMap), uint64(len(entries)))
+	for _, e := range entries {
+		buf = append(append(buf, e.k...), e.v...)
+	}
+	return buf, nil
+}
+
+func appendStruct(buf []byte, v reflect.Value) ([]byte, error) {
+	t := v.Type()
+	var fields []int
+	for i := 0; i < t.NumField(); i++ {
+		if t.Field(i).IsExported() {
+			fields = append(fields, i)
+		}
+	}
+	buf = binary.AppendUvarint(append(buf, tagMap), uint64(len(fields)))
+	var err error
+	for _, i := range fields {
+		name := t.Field(i).Name
+		buf = binary.AppendUvarint(append(buf, tagString), uint64(len(name)))
+		buf = append(buf, name...)
+		if buf, err = appendValue(buf, v.Field(i)); err != nil {
+			return nil, err
+		}
+	}
+	return buf, nil
+}
+
+// decoder reads the values encoded by appendValue
+type decoder struct {
+	data []byte
+}
+
+var errTruncated = errors.Wrap(ErrInvalidEncoding, "binary codec: truncated data")
+
+func (d *decoder) tag() (byte, error) {
+	if len(d.data) == 0 {
+		return 0, errTruncated
+	}
+	tag := d.data[0]
+	d.data = d.data[1:]
+	return tag, nil
+}
+
+func (d *decoder) uvarint() (uint64, error) {
+	n, read := binary.Uvarint(d.data)
+	if read <= 0 {
+		return 0, errors.Wrap(ErrInvalidEncoding, "binary codec: invalid uvarint")
+	}
+	d.data = d.data[read:]
+	return n, nil
+}
+
+func (d *decoder) varint() (int64, error) {
+	n, read := binary.Varint(d.data)
+	if read <= 0 {
+		return 0, errors.Wrap(ErrInvalidEncoding, "binary codec: invalid varint")
+	}
+	d.data = d.data[read:]
+	return n, nil
+}
+
+func (d *decoder) float() (float64, error) {
+	if len(d.data) < 8 {
+		return 0, errTruncated
+	}
+	f := math.Float64frombits(binary.BigEndian.Uint64(d.data))
+	d.data = d.data[8:]
+	return f, nil
+}
+
+// count reads the number of items of a list or map, each of them taking at least one byte
+func (d *decoder) count() (int, error) {
+	n, err := d.uvarint()
+	if err != nil {
+		return 0, err
+	}
+	if n > uint64(len(d.data)) {
+		return 0, errTruncated
+	}
+	return int(n), nil
+}
+
+// bytes reads a length-prefixed payload, sharing the memory of the data
+func (d *decoder) bytes() ([]byte, error) {
+	n, err := d.uvarint()
+	if err != nil {
+		return nil, err
+	}
+	if n > uint64(len(d.data)) {
+		return nil, errTruncated
+	}
+	data := d.data[:n]
+	d.data = d.data[n:]
+	return data, nil
+}
+
+func mismatch(tag byte, t reflect.Type) error {
+	return errors.Wrapf(ErrUnsupportedType, "binary codec: can't decode tag %d into %s", tag, t)
+}
+
+// decode reads the value starting with tag into v, which must be settable
+func (d *decoder) decode(tag byte, v reflect.Value) error {
+	if tag == tagNil {
+		v.SetZero()
+		return nil
+	}
+	if tag == tagBinary {
+		if u, ok := binaryUnmarshaler(v); ok {
+			data, err := d.bytes()
+			if err != nil {
+				return err
+			}
+			return u.UnmarshalBinary(bytes.Clone(data))
+		}
+	}
+	switch v.Kind() {
+	case reflect.Pointer:
+		if v.IsNil() {
+			v.Set(reflect.New(v.Type().Elem()))
+		}
+		return d.decode(tag, v.Elem())
+	case reflect.Interface:
+		if v.NumMethod() > 0 {
+			return mismatch(tag, v.Type())
+		}
+		x, err := d.decodeAny(tag)
+		if err != nil {
+			return err
+		}
+		if x == nil {
+			v.SetZero()
+		} else {
+			v.Set(reflect.ValueOf(x))
+		}
+		return nil
+	}
+
+	switch tag {
+	case tagFalse, tagTrue:
+		if v.Kind() != reflect.Bool {
+			return mismatch(tag, v.Type())
+		}
+		v.SetBool(tag == tagTrue)
+	case tagInt:
+		n, err := d.varint()
+		if err != nil {
+			return err
+		}
+		return setInt(v, tag, n)
+	case tagUint:
+		n, err := d.uvarint()
+		if err != nil {
+			return err
+		}
+		if n > math.MaxInt64 {
+			if !isUint(v.Kind()) || v.OverflowUint(n) {
+				return mismatch(tag, v.Type())
+			}
+			v.SetUint(n)
+			return nil
+		}
+		return setInt(v, tag, int64(n))
+	case tagFloat:
+		f, err := d.float()
+		if err != nil {
+			return err
+		}
+		if (v.Kind() != reflect.Float32 && v.Kind() != reflect.Float64) || v.OverflowFloat(f) {
+			return mismatch(tag, v.Type())
+		}
+		v.SetFloat(f)
+	case tagString, tagBytes, tagBinary:
+		data, err := d.bytes()
+		if err != nil {
+			return err
+		}
+		switch {
+		case v.Kind() == reflect.String:
+			v.SetString(string(data))
+		case v.Kind() == reflect.Slice && v.Type().Elem().Kind() == reflect.Uint8:
+			v.Set(reflect.MakeSlice(v.Type(), len(data), len(data)))
+			for i, b := range data {
+				v.Index(i).SetUint(uint64(b))
+			}
+		default:
+			return mismatch(tag, v.Type())
+		}
+	case tagList:
+		n, err := d.count()
+		if err != nil {
+			return err
+		}
+		switch v.Kind() {
+		case reflect.Slice:
+			v.Set(reflect.MakeSlice(v.Type(), n, n))
+		case reflect.Array:
+			if v.Len() != n {
+				return errors.Wrapf(ErrInvalidEncoding, "binary codec: %d items for %s", n, v.Type())
+			}
+		default:
+			return mismatch(tag, v.Type())
+		}
+		for i := 0; i < n; i++ {
+			if err := d.next(v.Index(i)); err != nil {
+				return err
+			}
+		}
+	case tagMap:
+		n, err := d.count()
+		if err != nil {
+			return err
+		}
+		switch v.Kind() {
+		case reflect.Map:
+			return d.decodeMap(n, v)
+		case reflect.Struct:
+			return d.decodeStruct(n, v)
+		}
+		return mismatch(tag, v.Type())
+	default:
+		return errors.Wrapf(ErrInvalidEncoding, "binary codec: unknown tag %d", tag)
+	}
+	return nil
+}
+
+// next decodes the next value into v
+func (d *decoder) next(v reflect.Value) error {
+	tag, err := d.tag()
+	if err != nil {
+		return err
+	}
+	return d.decode(tag, v)
+}
+
+// binaryUnmarshaler returns the encoding.BinaryUnmarshaler implemented by v, allocating it if
+// it's a nil pointer, or by its address
+func binaryUnmarshaler(v reflect.Value) (encoding.BinaryUnmarshaler, bool) {
+	switch {
+	case v.Kind() == reflect.Pointer && v.Type().Implements(binaryUnmarshalerType):
+		if v.IsNil() {
+			v.Set(reflect.New(v.Type().Elem()))
+		}
+		return v.Interface().(encoding.BinaryUnmarshaler), true
+	case v.Kind() != reflect.Pointer && v.CanAddr() && v.Addr().Type().Implements(binaryUnmarshalerType):
+		return v.Addr().Interface().(encoding.BinaryUnmarshaler), true
+	}
+	return nil, false
+}
+
+func isUint(kind reflect.Kind) bool {
+	switch kind {
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		return true
+	}
+	return false
+}
+
+// setInt stores an integer into an integer or float value, checking for overflows
+func setInt(v reflect.Value, tag byte, n int64) error {
+	switch v.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		if v.OverflowInt(n) {
+			return mismatch(tag, v.Type())
+		}
+		v.SetInt(n)
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		if n < 0 || v.OverflowUint(uint64(n)) {
+			return mismatch(tag, v.Type())
+		}
+		v.SetUint(uint64(n))
+	case reflect.Float32, reflect.Float64:
+		v.SetFloat(float64(n))
+	default:
+		return mismatch(tag, v.Type())
+	}
+	return nil
+}
+
+func (d *decoder) decodeMap(n int, v reflect.Value) error {
+	t := v.Type()
+	if v.IsNil() {
+		v.Set(reflect.MakeMapWithSize(t, n))
+	}
+	for i := 0; i < n; i++ {
+		k := reflect.New(t.Key()).Elem()
+		if err := d.next(k); err != nil {
+			return err
+		}
+		e := reflect.New(t.Elem()).Elem()
+		if err := d.next(e); err != nil {
+			return err
+		}
+		v.SetMapIndex(k, e)
+	}
+	return nil
+}
+
+// decodeStruct sets the exported fields named by the map keys, skipping the unknown ones
+func (d *decoder) decodeStruct(n int, v reflect.Value) error {
+	t := v.Type()
+	for i := 0; i < n; i++ {
+		var name string
+		if err := d.next(reflect.ValueOf(&name).Elem()); err != nil {
+			return err
+		}
+		f, ok := t.FieldByName(name)
+		if !ok || !f.IsExported() || len(f.Index) != 1 {
+			tag, err := d.tag()
+			if err != nil {
+				return err
+			}
+			if _, err := d.decodeAny(tag); err != nil {
+				return err
+			}
+			continue
+		}
+		if err := d.next(v.Field(f.Index[0])); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// decodeAny reads the value starting with tag into the natural go type: int64, uint64,
+// float64, string, []byte, []interface{}, and map[string]interface{} or, for other keys,
+// map[interface{}]interface{}
+func (d *decoder) decodeAny(tag byte) (interface{}, error) {
+	switch tag {
+	case tagNil:
+		return nil, nil
+	case tagFalse, tagTrue:
+		return tag == tagTrue, nil
+	case tagInt:
+		return d.varint()
+	case tagUint:
+		return d.uvarint()
+	case tagFloat:
+		return d.float()
+	case tagString:
+		data, err := d.bytes()
+		return string(data), err
+	case tagBytes, tagBinary:
+		data, err := d.bytes()
+		return bytes.Clone(data), err
+	case tagList:
+		n, err := d.count()
+		if err != nil {
+			return nil, err
+		}
+		items := make([]interface{}, n)
+		for i := range items {
+			if err := d.next(reflect.ValueOf(&items[i]).Elem()); err != nil {
+				return nil, err
+			}
+		}
+		return items, nil
+	case tagMap:
+		n, err := d.count()
+		if err != nil {
+			return nil, err
+		}
+		keys := make([]interface{}, n)
+		values := make([]interface{}, n)
+		stringKeys := true
+		for i := 0; i < n; i++ {
+			if err := d.next(reflect.ValueOf(&keys[i]).Elem()); err != nil {
+				return nil, err
+			}
+			if err := d.next(reflect.ValueOf(&values[i]).Elem()); err != nil {
+				return nil, err
+			}
+			if _, ok := keys[i].(string); !ok {
+				stringKeys = false
+			}
+		}
+		if stringKeys {
+			m := make(map[string]interface{}, n)
+			for i, k := range keys {
+				m[k.(string)] = values[i]
+			}
+			return m, nil
+		}
+		m := make(map[interface{}]interface{}, n)
+		for i, k := range keys {
+			if k != nil && !reflect.TypeOf(k).Comparable() {
+				return nil, errors.Wrapf(ErrUnsupportedType, "binary codec: map key %T", k)
+			}
+			m[k] = values[i]
+		}
+		return m, nil
+	}
+	return nil, errors.Wrapf(ErrInvalidEncoding, "binary codec: unknown tag %d", tag)
+}
@@ -0,0 +1,51 @@
+package hybrid
+
+import (
+	"os"
+	"strconv"
+	"strings"
+)
+
+const cgroupUnlimited = int64(1) << 62
+
+var cgroupMemoryFiles = []struct {
+	usage string
+	limit string
+}{
+	// cgroup v2
+	{usage: "/sys/fs/cgroup/memory.current", limit: "/sys/fs/cgroup/memory.max"},
+	// cgroup v1
+	{usage: "/sys/fs/cgroup/memory/memory.usage_in_bytes", limit: "/sys/fs/cgroup/memory/memory.limit_in_bytes"},
+}
+
+// readCgroupMemory returns the memory usage and limit of the current cgroup, ok is
+// false if they can't be read or the cgroup is unlimited
+func readCgroupMemory() (usage, limit int64, ok bool) {
+	for _, files := range cgroupMemoryFiles {
+		limit, err := readCgroupValue(files.limit)
+		if err != nil {
+			continue
+		}
+		if limit <= 0 || limit >= cgroupUnlimited {
+			return 0, 0, false
+		}
+		usage, err := readCgroupValue(files.usage)
+		if err != nil {
+			continue
+		}
+		return usage, limit, true
+	}
+	return 0, 0, false
+}
+
+func readCgroupValue(path string) (int64, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return 0, err
+	}
+	value := strings.TrimSpace(string(data))
+	if value == "max" {
+		return cgroupUnlimited, nil
+	}
+	return strconv.ParseInt(value, 10, 64)
+}
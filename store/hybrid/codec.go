@@ -0,0 +1,98 @@
+package hybrid
+
+import (
+	"bytes"
+	"encoding/gob"
+	"encoding/json"
+	"reflect"
+
+	"github.com/pkg/errors"
+)
+
+// Codec converts typed keys and values to and from their stored byte representation
+type Codec interface {
+	Marshal(v interface{}) ([]byte, error)
+	Unmarshal(data []byte, v interface{}) error
+}
+
+var (
+	// JSONCodec encodes values with encoding/json
+	JSONCodec Codec = jsonCodec{}
+	// GobCodec encodes values with encoding/gob
+	GobCodec Codec = gobCodec{}
+	// BinaryCodec encodes values in a compact self-describing binary form, msgpack style:
+	// numbers, bools, strings, byte slices, slices, arrays, maps, structs, pointers and
+	// encoding.BinaryMarshaler values. Structs are keyed by field name, so they can evolve
+	BinaryCodec Codec = binaryCodec{}
+	// RawCodec stores strings and byte slices as they are without any encoding
+	RawCodec Codec = rawCodec{}
+)
+
+type jsonCodec struct{}
+
+func (jsonCodec) Marshal(v interface{}) ([]byte, error) {
+	return json.Marshal(v)
+}
+
+func (jsonCodec) Unmarshal(data []byte, v interface{}) error {
+	return json.Unmarshal(data, v)
+}
+
+type gobCodec struct{}
+
+func (gobCodec) Marshal(v interface{}) ([]byte, error) {
+	var buf bytes.Buffer
+	if err := gob.NewEncoder(&buf).Encode(v); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+func (gobCodec) Unmarshal(data []byte, v interface{}) error {
+	return gob.NewDecoder(bytes.NewReader(data)).Decode(v)
+}
+
+type binaryCodec struct{}
+
+func (binaryCodec) Marshal(v interface{}) ([]byte, error) {
+	return appendValue(nil, reflect.ValueOf(v))
+}
+
+func (binaryCodec) Unmarshal(data []byte, v interface{}) error {
+	rv := reflect.ValueOf(v)
+	if rv.Kind() != reflect.Pointer || rv.IsNil() {
+		return errors.Wrapf(ErrUnsupportedType, "binary codec: %T", v)
+	}
+	d := &decoder{data: data}
+	if err := d.next(rv.Elem()); err != nil {
+		return err
+	}
+	if len(d.data) > 0 {
+		return errors.Wrap(ErrInvalidEncoding, "binary codec: trailing data")
+	}
+	return nil
+}
+
+type rawCodec struct{}
+
+func (rawCodec) Marshal(v interface{}) ([]byte, error) {
+	switch vv := v.(type) {
+	case []byte:
+		return vv, nil
+	case string:
+		return []byte(vv), nil
+	}
+	return nil, errors.Wrapf(ErrUnsupportedType, "raw codec: %T", v)
+}
+
+func (rawCodec) Unmarshal(data []byte, v interface{}) error {
+	switch vv := v.(type) {
+	case *[]byte:
+		*vv = append([]byte(nil), data...)
+		return nil
+	case *string:
+		*vv = string(data)
+		return nil
+	}
+	return errors.Wrapf(ErrUnsupportedType, "raw codec: %T", v)
+}
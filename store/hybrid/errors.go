@@ -0,0 +1,14 @@
+package hybrid
+
+import "github.com/pkg/errors"
+
+var (
+	// ErrUnsupportedType is returned when a codec can't handle the provided type
+	ErrUnsupportedType = errors.New("unsupported type")
+	// ErrInvalidEncoding is returned when a codec can't decode malformed data
+	ErrInvalidEncoding = errors.New("invalid encoding")
+	// ErrPersistentPath is returned when a persistent map is requested without a disk path
+	ErrPersistentPath = errors.New("persistent maps require a disk or hybrid type and a path")
+	// ErrNotFound is returned when the key doesn't exist
+	ErrNotFound = errors.New("key not found")
+)
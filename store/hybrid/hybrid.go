@@ -1,9 +1,12 @@
 package hybrid
 
 import (
+	"context"
+	"net/url"
 	"os"
 	"path/filepath"
 	"runtime"
+	"sync/atomic"
 	"time"
 
 	"github.com/projectdiscovery/hmap/store/cache"
@@ -29,6 +32,20 @@ const (
 	BuntDB
 )
 
+// String - returns the name the backend is registered with in the disk package
+func (t DBType) String() string {
+	switch t {
+	case PogrebDB:
+		return "pogreb"
+	case BBoltDB:
+		return "bbolt"
+	case BuntDB:
+		return "buntdb"
+	default:
+		return "leveldb"
+	}
+}
+
 type Options struct {
 	MemoryExpirationTime time.Duration
 	DiskExpirationTime   time.Duration
@@ -44,6 +61,40 @@ type Options struct {
 	Name                 string
 	// Remove temporary hmap in the temporary folder older than duration
 	RemoveOlderThan time.Duration
+	// Persistent keeps the disk store at Path on Close, flushing the memory tier into it,
+	// so that a later New with the same Path and DBType resumes with every key visible
+	Persistent bool
+	// MemoryMaxItems bounds the number of items held by the memory tier, 0 means unbounded
+	MemoryMaxItems int
+	// MemoryMaxBytes bounds the size of keys and values held by the memory tier, 0 means unbounded
+	MemoryMaxBytes int64
+	// MemoryEvictionPolicy selects the items evicted from the memory tier when a bound is exceeded.
+	// In Hybrid mode evicted items are spilled to disk
+	MemoryEvictionPolicy cache.EvictionPolicy
+	// MemoryExpirationMode selects whether MemoryExpirationTime runs from the write or slides
+	// on reads, bounded by MemoryMaxLifetime in cache.SlidingWithMaxLifetime mode. In Hybrid
+	// mode expired items are spilled to disk
+	MemoryExpirationMode cache.ExpirationMode
+	MemoryMaxLifetime    time.Duration
+	// MemoryShards partitions the memory tier into independently locked shards to reduce lock
+	// contention, the bounds are split evenly across them. 0 keeps a single partition
+	MemoryShards int
+	// MemoryGuardHighWatermark and MemoryGuardLowWatermark are the fractions of MaxMemorySize
+	// (or of the cgroup limit) above which the memory guard forces writes to disk and migrates
+	// the coldest items, and below which writes go to memory again
+	MemoryGuardHighWatermark float64
+	MemoryGuardLowWatermark  float64
+	// MemoryGuardCgroup makes the memory guard also react to the memory usage of the cgroup
+	MemoryGuardCgroup bool
+	// OnMemoryGuardEvent is called when the memory guard switches state or migrates items
+	OnMemoryGuardEvent func(MemoryGuardEvent)
+	// Backend is the name of a backend registered with disk.Register, overriding DBType.
+	// BackendParams are passed to its open function
+	Backend       string
+	BackendParams url.Values
+	// DiskSweeper deletes the expired records of the disk store in background when its
+	// Interval is set
+	DiskSweeper disk.SweeperOptions
 }
 
 var DefaultOptions = Options{
@@ -76,9 +127,18 @@ type HybridMap struct {
 	diskmap     disk.DB
 	diskmapPath string
 	memoryguard *memoryguard
+	sweeper     *disk.Sweeper
+	counters    counters
+	observer    atomic.Pointer[Observer]
+	deadlines   deadlines
+	forceDisk   atomic.Bool
 }
 
 func New(options Options) (*HybridMap, error) {
+	if options.Persistent && (options.Path == "" || options.Type == Memory) {
+		return nil, ErrPersistentPath
+	}
+
 	executableName := fileutil.ExecutableName()
 
 	// Due to potential system failures, the first operation is removing leftovers older than the defined duration
@@ -114,7 +174,21 @@ func New(options Options) (*HybridMap, error) {
 
 	var hm HybridMap
 	if options.Type == Memory || options.Type == Hybrid {
-		hm.memorymap = cache.New(options.MemoryExpirationTime, options.JanitorTime)
+		cacheOptions := cache.Options{
+			DefaultExpiration: options.MemoryExpirationTime,
+			CleanupInterval:   options.JanitorTime,
+			MaxItems:          options.MemoryMaxItems,
+			MaxBytes:          options.MemoryMaxBytes,
+			EvictionPolicy:    options.MemoryEvictionPolicy,
+			Shards:            options.MemoryShards,
+			ExpirationMode:    options.MemoryExpirationMode,
+			MaxLifetime:       options.MemoryMaxLifetime,
+		}
+		if options.MemoryShards > 0 {
+			hm.memorymap = cache.NewSharded(cacheOptions)
+		} else {
+			hm.memorymap = cache.NewWithOptions(cacheOptions)
+		}
 	}
 
 	if options.Type == Disk || options.Type == Hybrid {
@@ -127,89 +201,144 @@ func New(options Options) (*HybridMap, error) {
 			}
 		}
 
-		hm.diskmapPath = diskmapPathm
-		switch options.DBType {
-		case PogrebDB:
-			if disk.OpenPogrebDB == nil {
-				return nil, disk.ErrNotSupported
-			}
-			db, err := disk.OpenPogrebDB(diskmapPathm)
-			if err != nil {
-				return nil, err
-			}
-			hm.diskmap = db
-		case BBoltDB:
-			db, err := disk.OpenBoltDBB(filepath.Join(diskmapPathm, "bb"))
-			if err != nil {
-				return nil, err
-			}
-			db.BucketName = options.Name
-			hm.diskmap = db
-		case BuntDB:
-			db, err := disk.OpenBuntDB(filepath.Join(diskmapPathm, "bunt"))
-			if err != nil {
-				return nil, err
+		// removes the temporary folder created for the map on failure
+		cleanup := func() {
+			if options.Path == "" {
+				os.RemoveAll(diskmapPathm)
 			}
-			hm.diskmap = db
-		case LevelDB:
-			fallthrough
-		default:
-			db, err := disk.OpenLevelDB(diskmapPathm)
+		}
+
+		hm.diskmapPath = diskmapPathm
+		db, err := openDisk(options, diskmapPathm)
+		if err != nil {
+			cleanup()
+			return nil, err
+		}
+		hm.diskmap = db
+
+		if options.DiskSweeper.Interval > 0 {
+			sweeper, err := disk.NewSweeper(db, options.DiskSweeper)
 			if err != nil {
+				db.Close()
+				cleanup()
 				return nil, err
 			}
-			hm.diskmap = db
+			hm.sweeper = sweeper
 		}
 	}
 
 	if options.Type == Hybrid {
-		hm.memorymap.OnEvicted(func(k string, v interface{}) {
-			_ = hm.diskmap.Set(k, v.([]byte), 0)
+		// deleted and overwritten items are gone for good, the others move to disk
+		hm.memorymap.Subscribe(func(k string, v interface{}, reason cache.EvictionReason) {
+			if reason == cache.Expired || reason == cache.Capacity {
+				hm.spill(k, v.([]byte))
+			}
 		})
 	}
 
+	hm.options = &options
+	hm.forceDisk.Store(options.MemoryGuardForceDisk)
+
 	if options.MemoryGuard {
 		runMemoryGuard(&hm, options.MemoryGuardTime)
 		runtime.SetFinalizer(&hm, stopMemoryGuard)
 	}
 
-	hm.options = &options
-
 	return &hm, nil
 }
 
+// openDisk opens the disk store of the map with the configured backend
+func openDisk(options Options, path string) (disk.DB, error) {
+	name := options.Backend
+	if name == "" {
+		name = options.DBType.String()
+	}
+	params := url.Values{}
+	for k, v := range options.BackendParams {
+		params[k] = v
+	}
+	// single file backends live within the map folder
+	switch name {
+	case "bbolt":
+		path = filepath.Join(path, "bb")
+		if !params.Has("bucket") {
+			params.Set("bucket", options.Name)
+		}
+	case "buntdb":
+		path = filepath.Join(path, "bunt")
+	}
+	return disk.OpenBackend(name, path, params)
+}
+
 func (hm *HybridMap) Close() error {
+	stopMemoryGuard(hm)
+	// the disk store is closed even if the flush fails, releasing its lock
+	var flushErr error
+	if hm.options.Persistent {
+		flushErr = hm.Flush()
+	}
+	if hm.sweeper != nil {
+		hm.sweeper.Stop()
+	}
 	if hm.diskmap != (disk.DB)(nil) {
 		hm.diskmap.Close()
 	}
-	if hm.diskmapPath != "" && hm.options.Cleanup {
+	if flushErr != nil {
+		return flushErr
+	}
+	if hm.diskmapPath != "" && hm.options.Cleanup && !hm.options.Persistent {
 		return os.RemoveAll(hm.diskmapPath)
 	}
 	return nil
 }
 
-func (hm *HybridMap) Set(k string, v []byte) error {
-	var err error
-	switch hm.options.Type {
-	case Hybrid:
-		fallthrough
-	case Memory:
-		if hm.options.MemoryGuardForceDisk {
-			err = hm.diskmap.Set(k, v, hm.options.DiskExpirationTime)
-		} else {
-			hm.memorymap.Set(k, v)
+// Flush writes the items held by the memory tier of an Hybrid map to disk, so that
+// they survive a restart. It's a no-op for other map types
+func (hm *HybridMap) Flush() error {
+	defer hm.track(OpFlush)()
+
+	if hm.options.Type != Hybrid {
+		return nil
+	}
+	for k, item := range hm.memorymap.CloneItems() {
+		v, ok := item.Object.([]byte)
+		if !ok {
+			continue
 		}
-	case Disk:
-		err = hm.diskmap.Set(k, v, hm.options.DiskExpirationTime)
+		ttl, alive := hm.diskTTL(k, false)
+		if !alive {
+			continue
+		}
+		if err := hm.diskmap.Set(k, v, ttl); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// spill moves an item evicted from the memory tier to disk, preserving its deadline
+func (hm *HybridMap) spill(k string, v []byte) {
+	ttl, alive := hm.diskTTL(k, true)
+	if !alive {
+		_ = hm.diskmap.Del(k)
+		return
+	}
+	if hm.diskmap.Set(k, v, ttl) == nil {
+		hm.counters.spills.Add(1)
 	}
+}
 
-	return err
+func (hm *HybridMap) Set(k string, v []byte) error {
+	return hm.SetWithTTL(k, v, 0)
 }
 
 func (hm *HybridMap) Get(k string) ([]byte, bool) {
+	defer hm.track(OpGet)()
+
 	switch hm.options.Type {
 	case Memory:
 		v, ok := hm.memorymap.Get(k)
+		hm.counters.memoryLookup(ok)
 		if ok {
 			return v.([]byte), ok
 		}
@@ -217,16 +346,29 @@ func (hm *HybridMap) Get(k string) ([]byte, bool) {
 	case Hybrid:
 		v, ok := hm.memorymap.Get(k)
 		if ok {
+			if hm.expired(k) {
+				hm.counters.memoryLookup(false)
+				_ = hm.drop(k)
+				return []byte{}, false
+			}
+			hm.counters.memoryLookup(true)
 			return v.([]byte), ok
 		}
-		vm, err := hm.diskmap.Get(k)
-		// load it in memory since it has been recently used
-		if err == nil {
+		hm.counters.memoryLookup(false)
+		vm, expiration, err := hm.diskmap.GetWithExpiration(k)
+		hm.counters.diskLookup(err)
+		// load it in memory since it has been recently used, unless the memory guard forbids it,
+		// keeping the exact deadline of the record
+		if err == nil && !hm.forceDisk.Load() {
+			if !expiration.IsZero() {
+				hm.deadlines.set(k, expiration)
+			}
 			hm.memorymap.Set(k, vm)
 		}
 		return vm, err == nil
 	case Disk:
 		v, err := hm.diskmap.Get(k)
+		hm.counters.diskLookup(err)
 		return v, err == nil
 	}
 
@@ -234,12 +376,13 @@ func (hm *HybridMap) Get(k string) ([]byte, bool) {
 }
 
 func (hm *HybridMap) Del(key string) error {
+	defer hm.track(OpDel)()
+
 	switch hm.options.Type {
 	case Memory:
 		hm.memorymap.Delete(key)
 	case Hybrid:
-		hm.memorymap.Delete(key)
-		return hm.diskmap.Del(key)
+		return hm.drop(key)
 	case Disk:
 		return hm.diskmap.Del(key)
 	}
@@ -247,18 +390,22 @@ func (hm *HybridMap) Del(key string) error {
 	return nil
 }
 
+// drop removes a key from both tiers of an Hybrid map
+func (hm *HybridMap) drop(k string) error {
+	hm.memorymap.Delete(k)
+	hm.deadlines.del(k)
+	return hm.diskmap.Del(k)
+}
+
+// Scan - iterates over the whole map until f returns an error
 func (hm *HybridMap) Scan(f func([]byte, []byte) error) {
-	switch hm.options.Type {
-	case Memory:
-		hm.memorymap.Scan(f)
-	case Hybrid:
-		hm.memorymap.Scan(f)
-		_ = hm.diskmap.Scan(disk.ScannerOptions{Handler: f})
-	case Disk:
-		_ = hm.diskmap.Scan(disk.ScannerOptions{Handler: f})
-	}
+	_ = hm.ScanContext(context.Background(), ScanOptions{Handler: f})
 }
 
+// Size - returns the number of memory items plus the size of the disk store in bytes, without
+// scanning the map.
+//
+// Deprecated: use Len for the number of keys and DiskBytes for the size of the disk store
 func (hm *HybridMap) Size() int64 {
 	var count int64
 	if hm.memorymap != nil {
@@ -269,14 +416,3 @@ func (hm *HybridMap) Size() int64 {
 	}
 	return count
 }
-
-func (hm *HybridMap) TuneMemory() {
-	// si := sysinfo.Get()
-	var m runtime.MemStats
-	runtime.ReadMemStats(&m)
-	if m.Alloc >= uint64(hm.options.MaxMemorySize) {
-		hm.options.MemoryGuardForceDisk = true
-	} else {
-		hm.options.MemoryGuardForceDisk = false
-	}
-}
@@ -0,0 +1,689 @@
+package hybrid
+
+import (
+	"context"
+	"fmt"
+	"net/url"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/projectdiscovery/hmap/store/cache"
+	"github.com/projectdiscovery/hmap/store/disk"
+	"github.com/stretchr/testify/require"
+)
+
+type testRecord struct {
+	Host  string
+	Ports []int
+}
+
+func testOptions() map[string]Options {
+	all := map[string]Options{
+		"memory": DefaultMemoryOptions,
+	}
+	for name, dbType := range map[string]DBType{"leveldb": LevelDB, "pogreb": PogrebDB, "bbolt": BBoltDB, "buntdb": BuntDB} {
+		diskOpts := DefaultDiskOptions
+		diskOpts.DBType = dbType
+		diskOpts.Name = "test"
+		all["disk-"+name] = diskOpts
+
+		hybridOpts := DefaultHybridOptions
+		hybridOpts.DBType = dbType
+		hybridOpts.Name = "test"
+		hybridOpts.Cleanup = true
+		all["hybrid-"+name] = hybridOpts
+	}
+	return all
+}
+
+func TestTypedMap(t *testing.T) {
+	codecs := map[string]Codec{"json": JSONCodec, "gob": GobCodec, "binary": BinaryCodec}
+	for name, opts := range testOptions() {
+		for codecName, codec := range codecs {
+			t.Run(name+"-"+codecName, func(t *testing.T) {
+				m, err := NewMap[int, testRecord](opts, nil, codec)
+				require.Nil(t, err)
+				defer m.Close()
+
+				for i := 0; i < 10; i++ {
+					require.Nil(t, m.Set(i, testRecord{Host: fmt.Sprint("host", i), Ports: []int{i, i + 1}}))
+				}
+
+				v, ok, err := m.Get(3)
+				require.Nil(t, err)
+				require.True(t, ok)
+				require.Equal(t, testRecord{Host: "host3", Ports: []int{3, 4}}, v)
+
+				_, ok, err = m.Get(42)
+				require.Nil(t, err)
+				require.False(t, ok)
+
+				seen := map[int]testRecord{}
+				require.Nil(t, m.Scan(func(k int, v testRecord) error {
+					seen[k] = v
+					return nil
+				}))
+				require.Len(t, seen, 10)
+				require.Equal(t, "host7", seen[7].Host)
+			})
+		}
+	}
+}
+
+// corruptedDB fails the scans of the wrapped db
+type corruptedDB struct {
+	disk.DB
+}
+
+func (corruptedDB) Scan(disk.ScannerOptions) error {
+	return disk.ErrCorruptedRecord
+}
+
+func TestTypedMapScanError(t *testing.T) {
+	name := fmt.Sprintf("corrupted-%d", time.Now().UnixNano())
+	disk.Register(name, func(path string, _ url.Values) (disk.DB, error) {
+		db, err := disk.OpenLevelDB(path)
+		return corruptedDB{db}, err
+	})
+
+	opts := DefaultDiskOptions
+	opts.Backend = name
+	m, err := NewMap[string, string](opts, nil, nil)
+	require.Nil(t, err)
+	defer m.Close()
+	require.Nil(t, m.Set("a", "v"))
+	require.ErrorIs(t, m.Scan(func(string, string) error {
+		return nil
+	}), disk.ErrCorruptedRecord)
+}
+
+func TestBinaryCodec(t *testing.T) {
+	m, err := NewMap[string, uint64](DefaultMemoryOptions, nil, BinaryCodec)
+	require.Nil(t, err)
+	defer m.Close()
+
+	require.Nil(t, m.Set("a", 42))
+	v, ok, err := m.Get("a")
+	require.Nil(t, err)
+	require.True(t, ok)
+	require.Equal(t, uint64(42), v)
+
+	type nested struct {
+		Record  testRecord
+		Labels  map[string][]byte
+		Seen    time.Time
+		Parent  *testRecord
+		Missing *testRecord
+		Score   float32
+		Flags   [2]bool
+		Extra   interface{}
+		private int
+	}
+	in := nested{
+		Record: testRecord{Host: "example.com", Ports: []int{80, 443}},
+		Labels: map[string][]byte{"b": []byte("2"), "a": []byte("1")},
+		Seen:   time.Date(2024, 1, 2, 3, 4, 5, 6, time.UTC),
+		Parent: &testRecord{Host: "parent"},
+		Score:  0.5,
+		Flags:  [2]bool{true, false},
+		Extra:  []interface{}{int8(-1), "x"},
+	}
+	data, err := BinaryCodec.Marshal(in)
+	require.Nil(t, err)
+	// maps are sorted, so the encoding is deterministic
+	again, err := BinaryCodec.Marshal(in)
+	require.Nil(t, err)
+	require.Equal(t, data, again)
+	var out nested
+	require.Nil(t, BinaryCodec.Unmarshal(data, &out))
+	in.Extra = []interface{}{int64(-1), "x"}
+	require.Equal(t, in, out)
+
+	// values are self-describing
+	var generic interface{}
+	require.Nil(t, BinaryCodec.Unmarshal(data, &generic))
+	require.Equal(t, "example.com", generic.(map[string]interface{})["Record"].(map[string]interface{})["Host"])
+
+	// unknown fields are skipped, so structs can evolve
+	var record struct{ Host string }
+	data, err = BinaryCodec.Marshal(testRecord{Host: "h", Ports: []int{1}})
+	require.Nil(t, err)
+	require.Nil(t, BinaryCodec.Unmarshal(data, &record))
+	require.Equal(t, "h", record.Host)
+
+	data, err = BinaryCodec.Marshal(300)
+	require.Nil(t, err)
+	var small int8
+	require.ErrorIs(t, BinaryCodec.Unmarshal(data, &small), ErrUnsupportedType)
+	require.ErrorIs(t, BinaryCodec.Unmarshal(data[:1], new(int)), ErrInvalidEncoding)
+	require.ErrorIs(t, BinaryCodec.Unmarshal(append(data, 0), new(int)), ErrInvalidEncoding)
+	_, err = BinaryCodec.Marshal(make(chan int))
+	require.ErrorIs(t, err, ErrUnsupportedType)
+}
+
+func TestPersistentReopen(t *testing.T) {
+	for name, dbType := range map[string]DBType{"leveldb": LevelDB, "pogreb": PogrebDB, "bbolt": BBoltDB, "buntdb": BuntDB} {
+		t.Run(name, func(t *testing.T) {
+			opts := DefaultHybridOptions
+			opts.DBType = dbType
+			opts.Name = "test"
+			opts.Path = t.TempDir()
+			opts.Persistent = true
+
+			hm, err := New(opts)
+			require.Nil(t, err)
+			for i := 0; i < 100; i++ {
+				require.Nil(t, hm.Set(fmt.Sprint(i), []byte(fmt.Sprint(i))))
+			}
+			require.Nil(t, hm.Close())
+
+			hm, err = New(opts)
+			require.Nil(t, err)
+			defer hm.Close()
+			for i := 0; i < 100; i++ {
+				v, ok := hm.Get(fmt.Sprint(i))
+				require.True(t, ok)
+				require.Equal(t, fmt.Sprint(i), string(v))
+			}
+		})
+	}
+
+	_, err := New(Options{Type: Hybrid, Persistent: true})
+	require.ErrorIs(t, err, ErrPersistentPath)
+}
+
+func TestMemoryCapacitySpill(t *testing.T) {
+	opts := DefaultHybridOptions
+	opts.DBType = LevelDB
+	opts.Cleanup = true
+	opts.MemoryMaxItems = 10
+	hm, err := New(opts)
+	require.Nil(t, err)
+	defer hm.Close()
+
+	for i := 0; i < 100; i++ {
+		require.Nil(t, hm.Set(fmt.Sprint(i), []byte(fmt.Sprint(i))))
+	}
+	require.Equal(t, 10, hm.memorymap.ItemCount())
+	for i := 0; i < 100; i++ {
+		v, ok := hm.Get(fmt.Sprint(i))
+		require.True(t, ok)
+		require.Equal(t, fmt.Sprint(i), string(v))
+	}
+}
+
+func TestPerKeyTTL(t *testing.T) {
+	for name, opts := range map[string]Options{
+		"memory": DefaultMemoryOptions,
+		"disk":   DefaultDiskOptions,
+		"hybrid": {Type: Hybrid, DBType: LevelDB, Cleanup: true, MemoryMaxItems: 1, MemoryExpirationTime: time.Hour},
+	} {
+		t.Run(name, func(t *testing.T) {
+			hm, err := New(opts)
+			require.Nil(t, err)
+			defer hm.Close()
+
+			require.Nil(t, hm.SetWithTTL("short", []byte("v"), 2*time.Second))
+			require.Nil(t, hm.Set("persisted", []byte("v")))
+			require.Nil(t, hm.SetWithTTL("long", []byte("v"), time.Hour))
+			// in hybrid mode the bounded memory tier has spilled the first keys to disk
+			ttl, ok := hm.TTL("short")
+			require.True(t, ok)
+			require.True(t, ttl > 0 && ttl <= 2*time.Second, "unexpected ttl %s", ttl)
+
+			require.Nil(t, hm.Persist("long"))
+			ttl, ok = hm.TTL("long")
+			require.True(t, ok)
+			require.Equal(t, cache.NoExpiration, ttl)
+
+			require.Nil(t, hm.Expire("persisted", time.Hour))
+			ttl, ok = hm.TTL("persisted")
+			require.True(t, ok)
+			require.True(t, ttl > time.Minute)
+
+			require.ErrorIs(t, hm.Expire("missing", time.Hour), ErrNotFound)
+
+			time.Sleep(2100 * time.Millisecond)
+			_, ok = hm.Get("short")
+			require.False(t, ok)
+			_, ok = hm.TTL("short")
+			require.False(t, ok)
+			_, ok = hm.Get("long")
+			require.True(t, ok)
+		})
+	}
+}
+
+func TestExpireConcurrentSet(t *testing.T) {
+	opts := DefaultDiskOptions
+	opts.DBType = LevelDB
+	hm, err := New(opts)
+	require.Nil(t, err)
+	defer hm.Close()
+
+	require.Nil(t, hm.Set("k", []byte("0")))
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for i := 1; i <= 1000; i++ {
+			_ = hm.Set("k", []byte(fmt.Sprint(i)))
+		}
+	}()
+	for expiring := true; expiring; {
+		select {
+		case <-done:
+			expiring = false
+		default:
+		}
+		require.Nil(t, hm.Expire("k", time.Hour))
+	}
+	// the last write is never overwritten by the value read before it
+	v, ok := hm.Get("k")
+	require.True(t, ok)
+	require.Equal(t, "1000", string(v))
+}
+
+func TestPromotionKeepsDeadline(t *testing.T) {
+	hm, err := New(Options{Type: Hybrid, DBType: LevelDB, Cleanup: true, MemoryMaxItems: 1, MemoryExpirationTime: time.Hour})
+	require.Nil(t, err)
+	defer hm.Close()
+
+	require.Nil(t, hm.SetWithTTL("a", []byte("v"), 1500*time.Millisecond))
+	deadline, ok := hm.deadlines.get("a")
+	require.True(t, ok)
+	// spill a to disk and load it back
+	require.Nil(t, hm.Set("b", []byte("v")))
+	_, err = hm.diskmap.Get("a")
+	require.Nil(t, err)
+	_, ok = hm.Get("a")
+	require.True(t, ok)
+	promoted, ok := hm.deadlines.get("a")
+	require.True(t, ok)
+	require.WithinDuration(t, deadline, promoted, 10*time.Millisecond)
+}
+
+func TestExpiredShadowsDiskCopy(t *testing.T) {
+	hm, err := New(Options{Type: Hybrid, DBType: LevelDB, Cleanup: true, MemoryMaxItems: 1, MemoryExpirationTime: time.Hour})
+	require.Nil(t, err)
+	defer hm.Close()
+
+	// promoting a leaves its old copy on disk, shadowed by the memory one until it expires
+	require.Nil(t, hm.Set("a", []byte("old")))
+	require.Nil(t, hm.Set("b", []byte("v")))
+	_, ok := hm.Get("a")
+	require.True(t, ok)
+	require.Nil(t, hm.SetWithTTL("a", []byte("new"), 200*time.Millisecond))
+	time.Sleep(300 * time.Millisecond)
+
+	var keys []string
+	require.Nil(t, hm.ScanContext(context.Background(), ScanOptions{Handler: func(k, _ []byte) error {
+		keys = append(keys, string(k))
+		return nil
+	}}))
+	require.Equal(t, []string{"b"}, keys)
+	_, ok = hm.Get("a")
+	require.False(t, ok)
+}
+
+func TestLenSkipsStaleDiskCopy(t *testing.T) {
+	hm, err := New(Options{Type: Hybrid, DBType: LevelDB, Cleanup: true, MemoryMaxItems: 1, MemoryExpirationTime: time.Hour})
+	require.Nil(t, err)
+	defer hm.Close()
+
+	// the expired memory copy of a shadows its older disk copy
+	require.Nil(t, hm.Set("a", []byte("old")))
+	require.Nil(t, hm.Set("b", []byte("v")))
+	_, ok := hm.Get("a")
+	require.True(t, ok)
+	require.Nil(t, hm.SetWithTTL("a", []byte("new"), 200*time.Millisecond))
+	require.Equal(t, int64(2), hm.Len())
+	time.Sleep(300 * time.Millisecond)
+
+	diskReads := hm.Stats().DiskReads
+	require.Equal(t, int64(1), hm.Len())
+	require.Equal(t, int64(1), hm.Stats().Items)
+	require.Equal(t, diskReads, hm.Stats().DiskReads)
+	_, ok = hm.Get("a")
+	require.False(t, ok)
+}
+
+func TestMemoryGuard(t *testing.T) {
+	var events []MemoryGuardEvent
+	opts := DefaultHybridOptions
+	opts.DBType = LevelDB
+	opts.Cleanup = true
+	opts.MaxMemorySize = 1000
+	opts.OnMemoryGuardEvent = func(e MemoryGuardEvent) {
+		events = append(events, e)
+	}
+	hm, err := New(opts)
+	require.Nil(t, err)
+	defer hm.Close()
+
+	for i := 0; i < 100; i++ {
+		require.Nil(t, hm.Set(fmt.Sprintf("key-%03d", i), []byte("0123456789")))
+	}
+	hm.TuneMemory()
+	require.Equal(t, MemoryGuardForceDisk, hm.MemoryGuardState())
+	require.LessOrEqual(t, hm.memorymap.Bytes(), int64(700))
+	require.Len(t, events, 1)
+	require.Equal(t, MemoryGuardForceDisk, events[0].State)
+	require.Greater(t, events[0].Migrated, 0)
+
+	// writes bypass memory while forced to disk
+	require.Nil(t, hm.Set("forced", []byte("value")))
+	v, ok := hm.Get("forced")
+	require.True(t, ok)
+	require.Equal(t, "value", string(v))
+	for i := 0; i < 100; i++ {
+		_, ok := hm.Get(fmt.Sprintf("key-%03d", i))
+		require.True(t, ok)
+	}
+
+	hm.TuneMemory()
+	require.Equal(t, MemoryGuardNormal, hm.MemoryGuardState())
+	require.Len(t, events, 2)
+}
+
+func TestScanContext(t *testing.T) {
+	for name, dbType := range map[string]DBType{"leveldb": LevelDB, "pogreb": PogrebDB, "bbolt": BBoltDB, "buntdb": BuntDB} {
+		t.Run(name, func(t *testing.T) {
+			opts := DefaultHybridOptions
+			opts.DBType = dbType
+			opts.Name = "test"
+			opts.Cleanup = true
+			opts.MemoryMaxItems = 5
+			hm, err := New(opts)
+			require.Nil(t, err)
+			defer hm.Close()
+
+			for _, prefix := range []string{"a:", "b:"} {
+				for i := 0; i < 10; i++ {
+					require.Nil(t, hm.Set(fmt.Sprint(prefix, i), []byte("v")))
+				}
+			}
+			// promote spilled keys back to memory so that they exist in both tiers
+			for i := 0; i < 5; i++ {
+				_, ok := hm.Get(fmt.Sprint("a:", i))
+				require.True(t, ok)
+			}
+
+			collect := func(opts ScanOptions) []string {
+				var keys []string
+				opts.Handler = func(k, v []byte) error {
+					if opts.KeysOnly {
+						require.Nil(t, v)
+					}
+					keys = append(keys, string(k))
+					return nil
+				}
+				require.Nil(t, hm.ScanContext(context.Background(), opts))
+				return keys
+			}
+
+			require.Len(t, collect(ScanOptions{}), 20)
+			require.Len(t, collect(ScanOptions{Prefix: "a:"}), 10)
+			require.ElementsMatch(t, []string{"a:4", "a:5", "a:6", "a:7", "a:8", "a:9"}, collect(ScanOptions{Prefix: "a:", Offset: "a:3"}))
+			require.Len(t, collect(ScanOptions{Prefix: "b:", Offset: "b:3", IncludeOffset: true}), 7)
+			require.Len(t, collect(ScanOptions{Limit: 3, KeysOnly: true}), 3)
+
+			ctx, cancel := context.WithCancel(context.Background())
+			cancel()
+			err = hm.ScanContext(ctx, ScanOptions{Handler: func(k, v []byte) error { return nil }})
+			require.ErrorIs(t, err, context.Canceled)
+
+			// cancelled after the last memory key, the disk scan stops before reading a record,
+			// even the copies of memory keys which would be skipped
+			ctx, cancel = context.WithCancel(context.Background())
+			reads := hm.counters.diskReads.Load()
+			err = hm.ScanContext(ctx, ScanOptions{Prefix: "a:", Handler: func(k, v []byte) error {
+				if string(k) == "a:4" {
+					cancel()
+				}
+				return nil
+			}})
+			require.ErrorIs(t, err, context.Canceled)
+			require.Equal(t, reads, hm.counters.diskReads.Load())
+		})
+	}
+}
+
+func TestWriteBatch(t *testing.T) {
+	for name, opts := range map[string]Options{
+		"memory": DefaultMemoryOptions,
+		"disk":   DefaultDiskOptions,
+		"hybrid": {Type: Hybrid, DBType: LevelDB, Cleanup: true, MemoryExpirationTime: time.Hour},
+	} {
+		t.Run(name, func(t *testing.T) {
+			hm, err := New(opts)
+			require.Nil(t, err)
+			defer hm.Close()
+
+			require.Nil(t, hm.Set("counter", []byte("1")))
+			require.Nil(t, hm.Set("old", []byte("v")))
+			b := disk.NewBatch()
+			b.Put("new", []byte("v"), 0)
+			b.Incr("counter", 41)
+			b.Delete("old")
+			require.Nil(t, hm.WriteBatch(b))
+
+			v, ok := hm.Get("counter")
+			require.True(t, ok)
+			require.Equal(t, "42", string(v))
+			_, ok = hm.Get("new")
+			require.True(t, ok)
+			_, ok = hm.Get("old")
+			require.False(t, ok)
+		})
+	}
+}
+
+func TestBackendOption(t *testing.T) {
+	var opened string
+	name := fmt.Sprintf("test-%d", time.Now().UnixNano())
+	disk.Register(name, func(path string, params url.Values) (disk.DB, error) {
+		opened = params.Get("mode")
+		return disk.OpenBackend("leveldb", path, nil)
+	})
+
+	opts := DefaultDiskOptions
+	opts.Backend = name
+	opts.BackendParams = url.Values{"mode": {"fast"}}
+	hm, err := New(opts)
+	require.Nil(t, err)
+	defer hm.Close()
+	require.Equal(t, "fast", opened)
+	require.Nil(t, hm.Set("a", []byte("1")))
+	v, ok := hm.Get("a")
+	require.True(t, ok)
+	require.Equal(t, "1", string(v))
+
+	opts.Backend = "missing"
+	_, err = New(opts)
+	require.ErrorIs(t, err, disk.ErrNotSupported)
+}
+
+func TestDiskSweeper(t *testing.T) {
+	reclaimed := make(chan int, 16)
+	opts := DefaultDiskOptions
+	opts.DiskSweeper = disk.SweeperOptions{
+		Interval: 50 * time.Millisecond,
+		OnSweep: func(n int, err error) {
+			require.Nil(t, err)
+			reclaimed <- n
+		},
+	}
+	hm, err := New(opts)
+	require.Nil(t, err)
+	defer hm.Close()
+
+	for i := 0; i < 10; i++ {
+		require.Nil(t, hm.SetWithTTL(fmt.Sprint(i), []byte("v"), 100*time.Millisecond))
+	}
+	require.Nil(t, hm.Set("kept", []byte("v")))
+
+	total := 0
+	for total < 10 {
+		select {
+		case n := <-reclaimed:
+			total += n
+		case <-time.After(5 * time.Second):
+			t.Fatal("no sweep")
+		}
+	}
+	keys := 0
+	for range hm.Keys() {
+		keys++
+	}
+	require.Equal(t, 1, keys)
+}
+
+// unsweepableDB hides the sweeping support of the wrapped db
+type unsweepableDB struct {
+	disk.DB
+}
+
+func TestDiskSweeperFailure(t *testing.T) {
+	tmp := t.TempDir()
+	t.Setenv("TMPDIR", tmp)
+	name := fmt.Sprintf("unsweepable-%d", time.Now().UnixNano())
+	disk.Register(name, func(path string, _ url.Values) (disk.DB, error) {
+		db, err := disk.OpenLevelDB(path)
+		return unsweepableDB{db}, err
+	})
+
+	opts := DefaultDiskOptions
+	opts.Backend = name
+	opts.DiskSweeper = disk.SweeperOptions{Interval: time.Minute}
+	_, err := New(opts)
+	require.ErrorIs(t, err, disk.ErrNotSupported)
+	// the temporary folder of the map is removed
+	entries, err := os.ReadDir(tmp)
+	require.Nil(t, err)
+	require.Empty(t, entries)
+}
+
+func TestStats(t *testing.T) {
+	opts := DefaultHybridOptions
+	opts.DBType = LevelDB
+	opts.MemoryMaxItems = 5
+	opts.MemoryEvictionPolicy = cache.LRU
+	hm, err := New(opts)
+	require.Nil(t, err)
+	defer hm.Close()
+
+	for i := 0; i < 10; i++ {
+		require.Nil(t, hm.Set(fmt.Sprint(i), []byte("value")))
+	}
+	_, ok := hm.Get("9")
+	require.True(t, ok)
+	_, ok = hm.Get("0")
+	require.True(t, ok)
+	_, ok = hm.Get("missing")
+	require.False(t, ok)
+	// internal lookups are not counted
+	_, ok = hm.TTL("9")
+	require.True(t, ok)
+	_, ok = hm.TTL("missing")
+	require.False(t, ok)
+
+	stats := hm.Stats()
+	require.Equal(t, uint64(1), stats.Memory.Hits)
+	require.Equal(t, uint64(2), stats.Memory.Misses)
+	require.Equal(t, int64(10), hm.Len())
+	// reading the stats doesn't change them
+	require.Equal(t, stats.DiskReads, hm.Stats().DiskReads)
+	require.Equal(t, int64(10), stats.Items)
+	require.Equal(t, uint64(1), stats.MemoryHits)
+	require.Equal(t, uint64(2), stats.MemoryMisses)
+	require.Equal(t, uint64(1), stats.DiskHits)
+	require.Equal(t, uint64(1), stats.DiskMisses)
+	require.GreaterOrEqual(t, stats.Evictions, uint64(5))
+	require.GreaterOrEqual(t, stats.Spills, uint64(5))
+	require.Equal(t, hm.DiskBytes(), stats.DiskBytes)
+	require.Positive(t, stats.Bytes)
+
+	// the counters skip the items and leave the disk reads untouched
+	counters := hm.Counters()
+	require.Zero(t, counters.Items)
+	require.Zero(t, counters.Bytes)
+	require.Zero(t, counters.Disk.Items)
+	require.Equal(t, stats.DiskReads, counters.DiskReads)
+	require.Equal(t, stats.MemoryHits, counters.MemoryHits)
+	require.Equal(t, stats.DiskHits, counters.DiskHits)
+	require.Equal(t, stats.Evictions, counters.Evictions)
+	require.Equal(t, stats.DiskBytes, counters.DiskBytes)
+	require.Equal(t, stats.Disk.Hits, counters.Disk.Hits)
+}
+
+func TestMemoryShards(t *testing.T) {
+	opts := DefaultHybridOptions
+	opts.Cleanup = true
+	opts.MemoryMaxItems = 40
+	opts.MemoryShards = 4
+	hm, err := New(opts)
+	require.Nil(t, err)
+	defer hm.Close()
+
+	for i := 0; i < 200; i++ {
+		require.Nil(t, hm.Set(fmt.Sprint(i), []byte("value")))
+	}
+	require.LessOrEqual(t, hm.memorymap.ItemCount(), 40)
+	for i := 0; i < 200; i++ {
+		v, ok := hm.Get(fmt.Sprint(i))
+		require.True(t, ok, "key %d", i)
+		require.Equal(t, []byte("value"), v)
+	}
+	require.Equal(t, int64(200), hm.Len())
+}
+
+func TestSlidingMemoryExpiration(t *testing.T) {
+	opts := DefaultHybridOptions
+	opts.Cleanup = true
+	opts.MemoryExpirationTime = 100 * time.Millisecond
+	opts.MemoryExpirationMode = cache.Sliding
+	opts.JanitorTime = 20 * time.Millisecond
+	hm, err := New(opts)
+	require.Nil(t, err)
+	defer hm.Close()
+
+	require.Nil(t, hm.Set("hot", []byte("v")))
+	require.Nil(t, hm.Set("cold", []byte("v")))
+	for i := 0; i < 10; i++ {
+		time.Sleep(30 * time.Millisecond)
+		_, ok := hm.memorymap.Get("hot")
+		require.True(t, ok)
+	}
+	// the idle key has been spilled to disk by the janitor
+	_, _, ok := hm.memorymap.GetWithExpiration("cold")
+	require.False(t, ok)
+	_, err = hm.diskmap.Get("cold")
+	require.Nil(t, err)
+	v, ok := hm.Get("cold")
+	require.True(t, ok)
+	require.Equal(t, []byte("v"), v)
+}
+
+func TestDelDoesNotSpill(t *testing.T) {
+	opts := DefaultHybridOptions
+	opts.Cleanup = true
+	opts.MemoryMaxItems = 1
+	hm, err := New(opts)
+	require.Nil(t, err)
+	defer hm.Close()
+
+	require.Nil(t, hm.Set("deleted", []byte("v")))
+	require.Nil(t, hm.Set("deleted", []byte("v2")))
+	require.Nil(t, hm.Del("deleted"))
+	require.Zero(t, hm.Stats().Spills)
+	_, err = hm.diskmap.Get("deleted")
+	require.Error(t, err)
+
+	require.Nil(t, hm.Set("a", []byte("v")))
+	require.Nil(t, hm.Set("b", []byte("v")))
+	require.Equal(t, uint64(1), hm.Stats().Spills)
+	v, err := hm.diskmap.Get("a")
+	require.Nil(t, err)
+	require.Equal(t, []byte("v"), v)
+}
@@ -0,0 +1,45 @@
+package hybrid
+
+import (
+	"context"
+	"iter"
+
+	"github.com/pkg/errors"
+)
+
+var errStopIteration = errors.New("stop iteration")
+
+// All - returns an iterator over all the items of the map, deduplicated across tiers
+func (hm *HybridMap) All() iter.Seq2[[]byte, []byte] {
+	return hm.Prefix("")
+}
+
+// Keys - returns an iterator over all the keys of the map
+func (hm *HybridMap) Keys() iter.Seq[[]byte] {
+	return func(yield func([]byte) bool) {
+		_ = hm.ScanContext(context.Background(), ScanOptions{
+			KeysOnly: true,
+			Handler: func(k, _ []byte) error {
+				if !yield(k) {
+					return errStopIteration
+				}
+				return nil
+			},
+		})
+	}
+}
+
+// Prefix - returns an iterator over the items whose key starts with p
+func (hm *HybridMap) Prefix(p string) iter.Seq2[[]byte, []byte] {
+	return func(yield func([]byte, []byte) bool) {
+		_ = hm.ScanContext(context.Background(), ScanOptions{
+			Prefix: p,
+			Handler: func(k, v []byte) error {
+				if !yield(k, v) {
+					return errStopIteration
+				}
+				return nil
+			},
+		})
+	}
+}
@@ -1,11 +1,52 @@
 package hybrid
 
-import "time"
+import (
+	"sync"
+	"time"
+)
+
+// MemoryGuardState - represents the state of the memory guard
+type MemoryGuardState int
+
+const (
+	// MemoryGuardNormal - new items are written to the memory tier
+	MemoryGuardNormal MemoryGuardState = iota
+	// MemoryGuardForceDisk - new items bypass the memory tier and are written to disk
+	MemoryGuardForceDisk
+)
+
+func (s MemoryGuardState) String() string {
+	if s == MemoryGuardForceDisk {
+		return "force-disk"
+	}
+	return "normal"
+}
+
+// MemoryGuardEvent - describes a state change of the memory guard
+type MemoryGuardEvent struct {
+	State MemoryGuardState
+	// Bytes held by the memory tier before the migration
+	Bytes int64
+	// Limit is the configured MaxMemorySize
+	Limit int64
+	// CgroupUsage and CgroupLimit are set when the cgroup memory is monitored
+	CgroupUsage int64
+	CgroupLimit int64
+	// Migrated is the number of items moved from memory to disk
+	Migrated int
+}
+
+const (
+	DefaultMemoryGuardHighWatermark = 0.9
+	DefaultMemoryGuardLowWatermark  = 0.7
+)
 
 type memoryguard struct {
-	Enabled  bool
 	Interval time.Duration
-	stop     chan bool
+	stop     chan struct{}
+	stopOnce sync.Once
+	// serializes concurrent tuning
+	mu sync.Mutex
 }
 
 func (mg *memoryguard) Run(hm *HybridMap) {
@@ -22,14 +63,84 @@ func (mg *memoryguard) Run(hm *HybridMap) {
 }
 
 func stopMemoryGuard(hm *HybridMap) {
-	hm.memoryguard.stop <- true
+	if hm.memoryguard == nil {
+		return
+	}
+	hm.memoryguard.stopOnce.Do(func() {
+		close(hm.memoryguard.stop)
+	})
 }
 
 func runMemoryGuard(c *HybridMap, ci time.Duration) {
 	mg := &memoryguard{
 		Interval: ci,
-		stop:     make(chan bool),
+		stop:     make(chan struct{}),
 	}
 	c.memoryguard = mg
 	go mg.Run(c)
 }
+
+// MemoryGuardState returns the current state of the memory guard
+func (hm *HybridMap) MemoryGuardState() MemoryGuardState {
+	if hm.forceDisk.Load() {
+		return MemoryGuardForceDisk
+	}
+	return MemoryGuardNormal
+}
+
+func (hm *HybridMap) watermarks() (high, low float64) {
+	high, low = hm.options.MemoryGuardHighWatermark, hm.options.MemoryGuardLowWatermark
+	if high <= 0 || high > 1 {
+		high = DefaultMemoryGuardHighWatermark
+	}
+	if low <= 0 || low > high {
+		low = min(DefaultMemoryGuardLowWatermark, high)
+	}
+	return high, low
+}
+
+// TuneMemory compares the bytes held by the memory tier of an Hybrid map (and optionally the
+// cgroup memory usage) with the configured limits. Above the high watermark new writes are
+// forced to disk and the coldest memory items are migrated to disk down to the low watermark,
+// below the low watermark writes go to memory again
+func (hm *HybridMap) TuneMemory() {
+	if hm.options.Type != Hybrid {
+		return
+	}
+	if hm.memoryguard != nil {
+		hm.memoryguard.mu.Lock()
+		defer hm.memoryguard.mu.Unlock()
+	}
+
+	event := MemoryGuardEvent{
+		Bytes: hm.memorymap.Bytes(),
+		Limit: int64(hm.options.MaxMemorySize),
+	}
+	var pressure float64
+	if event.Limit > 0 {
+		pressure = float64(event.Bytes) / float64(event.Limit)
+	}
+	if hm.options.MemoryGuardCgroup {
+		if usage, limit, ok := readCgroupMemory(); ok {
+			event.CgroupUsage, event.CgroupLimit = usage, limit
+			pressure = max(pressure, float64(usage)/float64(limit))
+		}
+	}
+
+	high, low := hm.watermarks()
+	previous := hm.MemoryGuardState()
+	switch {
+	case pressure >= high:
+		hm.forceDisk.Store(true)
+		// bring the memory tier down proportionally to the low watermark
+		target := int64(float64(event.Bytes) * low / pressure)
+		event.Migrated = hm.memorymap.Shrink(target)
+	case pressure <= low:
+		hm.forceDisk.Store(false)
+	}
+	event.State = hm.MemoryGuardState()
+
+	if hm.options.OnMemoryGuardEvent != nil && (event.State != previous || event.Migrated > 0) {
+		hm.options.OnMemoryGuardEvent(event)
+	}
+}
@@ -0,0 +1,37 @@
+package hybrid
+
+import "time"
+
+// Operations reported to the observer
+const (
+	OpSet   = "set"
+	OpGet   = "get"
+	OpDel   = "del"
+	OpScan  = "scan"
+	OpBatch = "batch"
+	OpFlush = "flush"
+)
+
+// Observer - receives the duration of every map operation
+type Observer func(op string, d time.Duration)
+
+// Observe - sets the observer of the map operations, nil removes it
+func (hm *HybridMap) Observe(o Observer) {
+	if o == nil {
+		hm.observer.Store(nil)
+		return
+	}
+	hm.observer.Store(&o)
+}
+
+// track starts timing op, the returned function reports it to the observer
+func (hm *HybridMap) track(op string) func() {
+	o := hm.observer.Load()
+	if o == nil {
+		return func() {}
+	}
+	start := time.Now()
+	return func() {
+		(*o)(op, time.Since(start))
+	}
+}
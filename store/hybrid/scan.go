@@ -0,0 +1,153 @@
+package hybrid
+
+import (
+	"context"
+	"sort"
+	"strings"
+
+	"github.com/pkg/errors"
+	"github.com/projectdiscovery/hmap/store/disk"
+)
+
+// ScanOptions - represents the options of a scan
+type ScanOptions struct {
+	// Prefix that each key must have
+	Prefix string
+	// Offset is the key from which to start in lexicographic order
+	Offset string
+	// IncludeOffset whether to include the offset key or not
+	IncludeOffset bool
+	// Limit is the maximum number of items to yield, 0 means unlimited
+	Limit int
+	// KeysOnly yields nil values
+	KeysOnly bool
+	// Handler receives each item, returning an error stops the scan and the error is returned
+	Handler func(k, v []byte) error
+}
+
+// errScanDone stops the disk scan once the limit is reached
+var errScanDone = errors.New("scan done")
+
+type scanner struct {
+	ctx     context.Context
+	opts    ScanOptions
+	seen    map[string]struct{}
+	yielded int
+	err     error
+}
+
+// match returns true if the key satisfies prefix and offset
+func (s *scanner) match(k string) bool {
+	if s.opts.Prefix != "" && !strings.HasPrefix(k, s.opts.Prefix) {
+		return false
+	}
+	if s.opts.Offset != "" {
+		if k < s.opts.Offset || (!s.opts.IncludeOffset && k == s.opts.Offset) {
+			return false
+		}
+	}
+	return true
+}
+
+// yield passes an item to the handler and records the error which stops the scan
+func (s *scanner) yield(k, v []byte) error {
+	if s.err = s.ctx.Err(); s.err != nil {
+		return s.err
+	}
+	if s.opts.KeysOnly {
+		v = nil
+	}
+	if s.err = s.opts.Handler(k, v); s.err != nil {
+		return s.err
+	}
+	s.yielded++
+	if s.opts.Limit > 0 && s.yielded >= s.opts.Limit {
+		s.err = errScanDone
+	}
+	return s.err
+}
+
+// ScanContext - iterates over the map until the handler returns an error, the limit is reached or
+// the context is done. In Hybrid mode memory items are yielded first, in key order, and take
+// precedence over their disk copies, which are skipped
+func (hm *HybridMap) ScanContext(ctx context.Context, opts ScanOptions) error {
+	defer hm.track(OpScan)()
+
+	return hm.scanContext(ctx, opts)
+}
+
+func (hm *HybridMap) scanContext(ctx context.Context, opts ScanOptions) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	s := &scanner{ctx: ctx, opts: opts}
+
+	if hm.options.Type == Memory || hm.options.Type == Hybrid {
+		items := hm.memorymap.CloneItems()
+		keys := make([]string, 0, len(items))
+		for k := range items {
+			if s.match(k) {
+				keys = append(keys, k)
+			}
+		}
+		sort.Strings(keys)
+		if hm.options.Type == Hybrid {
+			s.seen = make(map[string]struct{}, len(keys))
+		}
+		for _, k := range keys {
+			v, ok := items[k].Object.([]byte)
+			if !ok {
+				continue
+			}
+			if s.seen != nil {
+				s.seen[k] = struct{}{}
+			}
+			if hm.expired(k) {
+				// as Get does, the key is dropped along with the older disk copy left behind by
+				// its promotion, which must not be yielded by the disk scan
+				if hm.options.Type == Hybrid {
+					_ = hm.drop(k)
+				}
+				continue
+			}
+			if s.yield([]byte(k), v) != nil {
+				return s.result()
+			}
+		}
+	}
+
+	if hm.options.Type == Disk || hm.options.Type == Hybrid {
+		err := hm.diskmap.Scan(disk.ScannerOptions{
+			Prefix:        opts.Prefix,
+			Offset:        opts.Offset,
+			IncludeOffset: opts.IncludeOffset,
+			FetchValues:   !opts.KeysOnly,
+			Handler: func(k, v []byte) error {
+				// filtered records must not delay the cancellation of unsorted scans
+				if s.err = s.ctx.Err(); s.err != nil {
+					return s.err
+				}
+				hm.counters.diskReads.Add(1)
+				if !s.match(string(k)) {
+					return nil
+				}
+				if _, ok := s.seen[string(k)]; ok {
+					return nil
+				}
+				return s.yield(k, v)
+			},
+		})
+		if s.err == nil && err != nil {
+			return err
+		}
+	}
+
+	return s.result()
+}
+
+func (s *scanner) result() error {
+	if s.err == errScanDone {
+		return nil
+	}
+	return s.err
+}
@@ -0,0 +1,150 @@
+package hybrid
+
+import (
+	"sync/atomic"
+
+	"github.com/projectdiscovery/hmap/store/cache"
+	"github.com/projectdiscovery/hmap/store/disk"
+)
+
+// Stats - represents the statistics of a map
+type Stats struct {
+	// Items is the number of live keys, as returned by Len
+	Items int64
+	// Bytes is the size of the keys and values held by both tiers
+	Bytes int64
+	// DiskBytes is the size of the disk store files, as returned by DiskBytes
+	DiskBytes int64
+	// Expired is the number of expired items not deleted yet
+	Expired int64
+	// MemoryHits, MemoryMisses, DiskHits and DiskMisses count the Get lookups per tier
+	MemoryHits   uint64
+	MemoryMisses uint64
+	DiskHits     uint64
+	DiskMisses   uint64
+	// Evictions counts the items evicted from the memory tier
+	Evictions uint64
+	// Spills counts the items moved from memory to disk
+	Spills uint64
+	// DiskReads counts the records read from the disk store by lookups and scans
+	DiskReads uint64
+	// Memory and Disk are the statistics of the underlying stores, when present
+	Memory cache.Stats
+	Disk   disk.Stats
+}
+
+type counters struct {
+	memoryHits   atomic.Uint64
+	memoryMisses atomic.Uint64
+	diskHits     atomic.Uint64
+	diskMisses   atomic.Uint64
+	spills       atomic.Uint64
+	diskReads    atomic.Uint64
+}
+
+func (c *counters) memoryLookup(hit bool) {
+	if hit {
+		c.memoryHits.Add(1)
+	} else {
+		c.memoryMisses.Add(1)
+	}
+}
+
+func (c *counters) diskLookup(err error) {
+	c.diskReads.Add(1)
+	if err == nil {
+		c.diskHits.Add(1)
+	} else {
+		c.diskMisses.Add(1)
+	}
+}
+
+// Counters - returns the statistics of the map without counting its items: Items, Bytes and
+// Expired are left zero, and Memory and Disk hold the counters of the underlying stores. It
+// never scans the stores and is cheap enough to be called on every metrics scrape
+func (hm *HybridMap) Counters() Stats {
+	stats := Stats{
+		MemoryHits:   hm.counters.memoryHits.Load(),
+		MemoryMisses: hm.counters.memoryMisses.Load(),
+		DiskHits:     hm.counters.diskHits.Load(),
+		DiskMisses:   hm.counters.diskMisses.Load(),
+		Spills:       hm.counters.spills.Load(),
+		DiskReads:    hm.counters.diskReads.Load(),
+	}
+	if hm.memorymap != nil {
+		stats.Memory = hm.memorymap.Counters()
+		stats.Evictions = stats.Memory.Evictions
+	}
+	if hm.diskmap != (disk.DB)(nil) {
+		stats.Disk = hm.diskmap.Counters()
+		stats.DiskBytes = stats.Disk.DiskBytes
+	}
+	return stats
+}
+
+// Stats - returns the statistics of the map. Counting the items requires a full pass over the
+// disk store
+func (hm *HybridMap) Stats() Stats {
+	items, diskStats := hm.count()
+	stats := hm.Counters()
+	stats.Items = items
+	stats.DiskBytes = diskStats.DiskBytes
+	stats.Disk = diskStats
+	if hm.memorymap != nil {
+		stats.Memory = hm.memorymap.Stats()
+		stats.Bytes += stats.Memory.Bytes
+		stats.Expired += int64(stats.Memory.Expired)
+		stats.Evictions = stats.Memory.Evictions
+	}
+	stats.Bytes += diskStats.Bytes
+	stats.Expired += diskStats.Expired
+	return stats
+}
+
+// Len - returns the number of live keys, counting once the keys held by both tiers.
+// It requires a full pass over the disk store
+func (hm *HybridMap) Len() int64 {
+	n, _ := hm.count()
+	return n
+}
+
+// count returns the number of live keys along with the statistics of the disk store, which
+// are gathered with a single pass and provide its count. The disk copies of the memory keys
+// are skipped: the live ones are counted once, and the expired ones shadow a stale copy that
+// Get reports missing
+func (hm *HybridMap) count() (int64, disk.Stats) {
+	var (
+		n         int64
+		diskStats disk.Stats
+		memory    map[string]struct{}
+	)
+	if hm.memorymap != nil {
+		items := hm.memorymap.CloneItems()
+		memory = make(map[string]struct{}, len(items))
+		for k, item := range items {
+			if _, ok := item.Object.([]byte); !ok {
+				continue
+			}
+			memory[k] = struct{}{}
+			if !hm.expired(k) {
+				n++
+			}
+		}
+	}
+	if hm.diskmap != (disk.DB)(nil) {
+		diskStats = hm.diskmap.StatsWithKeys(func(k []byte) {
+			if _, ok := memory[string(k)]; !ok {
+				n++
+			}
+		})
+	}
+	return n, diskStats
+}
+
+// DiskBytes - returns the size of the disk store files, 0 for memory maps
+func (hm *HybridMap) DiskBytes() int64 {
+	if hm.diskmap == (disk.DB)(nil) {
+		return 0
+	}
+	return hm.diskmap.Size()
+}
@@ -0,0 +1,199 @@
+package hybrid
+
+import (
+	"sync"
+	"time"
+
+	"github.com/projectdiscovery/hmap/store/cache"
+)
+
+// deadlines tracks the per-key expiration of the items held by the memory tier of an
+// Hybrid map, as there the memory cache expiration only decides when items are spilled
+// to disk. A zero time marks a key explicitly persisted
+type deadlines struct {
+	mu sync.Mutex
+	m  map[string]time.Time
+}
+
+func (d *deadlines) set(k string, t time.Time) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if d.m == nil {
+		d.m = make(map[string]time.Time)
+	}
+	d.m[k] = t
+}
+
+func (d *deadlines) get(k string) (time.Time, bool) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	t, ok := d.m[k]
+	return t, ok
+}
+
+func (d *deadlines) pop(k string) (time.Time, bool) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	t, ok := d.m[k]
+	delete(d.m, k)
+	return t, ok
+}
+
+func (d *deadlines) del(k string) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	delete(d.m, k)
+}
+
+// expired returns true if the memory item of an Hybrid map is past its deadline
+func (hm *HybridMap) expired(k string) bool {
+	deadline, ok := hm.deadlines.get(k)
+	return ok && !deadline.IsZero() && !time.Now().Before(deadline)
+}
+
+// diskTTL returns the ttl to use when writing a memory item to disk and whether it's still alive
+func (hm *HybridMap) diskTTL(k string, pop bool) (time.Duration, bool) {
+	var (
+		deadline time.Time
+		ok       bool
+	)
+	if pop {
+		deadline, ok = hm.deadlines.pop(k)
+	} else {
+		deadline, ok = hm.deadlines.get(k)
+	}
+	switch {
+	case !ok:
+		return hm.options.DiskExpirationTime, true
+	case deadline.IsZero():
+		return 0, true
+	default:
+		ttl := time.Until(deadline)
+		return ttl, ttl > 0
+	}
+}
+
+// SetWithTTL - sets a key expiring after ttl, a non positive ttl falls back to the default expiration
+func (hm *HybridMap) SetWithTTL(k string, v []byte, ttl time.Duration) error {
+	defer hm.track(OpSet)()
+
+	var err error
+	switch hm.options.Type {
+	case Hybrid:
+		if hm.forceDisk.Load() {
+			// drop the stale memory copy, which would shadow the disk one
+			if _, _, ok := hm.memorymap.Peek(k); ok {
+				hm.memorymap.Delete(k)
+			}
+			hm.deadlines.del(k)
+			if ttl <= 0 {
+				ttl = hm.options.DiskExpirationTime
+			}
+			err = hm.diskmap.Set(k, v, ttl)
+		} else {
+			if ttl > 0 {
+				hm.deadlines.set(k, time.Now().Add(ttl))
+			} else {
+				hm.deadlines.del(k)
+			}
+			hm.memorymap.Set(k, v)
+		}
+	case Memory:
+		if ttl <= 0 {
+			ttl = cache.DefaultExpiration
+		}
+		hm.memorymap.SetWithExpiration(k, v, ttl)
+	case Disk:
+		if ttl <= 0 {
+			ttl = hm.options.DiskExpirationTime
+		}
+		err = hm.diskmap.Set(k, v, ttl)
+	}
+
+	return err
+}
+
+// TTL - returns the remaining time to live of a key, cache.NoExpiration if it never expires,
+// and false if the key doesn't exist
+func (hm *HybridMap) TTL(k string) (time.Duration, bool) {
+	switch hm.options.Type {
+	case Memory:
+		_, expiration, ok := hm.memorymap.Peek(k)
+		if !ok {
+			return 0, false
+		}
+		if expiration.IsZero() {
+			return cache.NoExpiration, true
+		}
+		return time.Until(expiration), true
+	case Hybrid:
+		if _, _, ok := hm.memorymap.Peek(k); ok {
+			deadline, ok := hm.deadlines.get(k)
+			if !ok || deadline.IsZero() {
+				return cache.NoExpiration, true
+			}
+			ttl := time.Until(deadline)
+			return ttl, ttl > 0
+		}
+		fallthrough
+	case Disk:
+		switch ttl := hm.diskmap.TTL(k); {
+		case ttl == -1:
+			return cache.NoExpiration, true
+		case ttl < 0:
+			return 0, false
+		default:
+			return time.Duration(ttl) * time.Second, true
+		}
+	}
+	return 0, false
+}
+
+// Expire - sets the time to live of an existing key, a non positive ttl removes the key
+func (hm *HybridMap) Expire(k string, ttl time.Duration) error {
+	if ttl <= 0 {
+		return hm.Del(k)
+	}
+	return hm.updateTTL(k, ttl)
+}
+
+// Persist - removes the time to live of an existing key
+func (hm *HybridMap) Persist(k string) error {
+	return hm.updateTTL(k, 0)
+}
+
+// updateTTL sets the deadline of an existing key, a zero ttl means no expiration
+func (hm *HybridMap) updateTTL(k string, ttl time.Duration) error {
+	switch hm.options.Type {
+	case Memory:
+		v, _, ok := hm.memorymap.Peek(k)
+		if !ok {
+			return ErrNotFound
+		}
+		if ttl == 0 {
+			ttl = cache.NoExpiration
+		}
+		hm.memorymap.SetWithExpiration(k, v, ttl)
+		return nil
+	case Hybrid:
+		if _, _, ok := hm.memorymap.Peek(k); ok && !hm.expired(k) {
+			var deadline time.Time
+			if ttl > 0 {
+				deadline = time.Now().Add(ttl)
+			}
+			hm.deadlines.set(k, deadline)
+			return nil
+		}
+		fallthrough
+	case Disk:
+		// the ttl is set atomically, so a concurrent write isn't overwritten with the old value
+		found, err := hm.diskmap.SetTTL(k, ttl)
+		if err != nil {
+			return err
+		}
+		if !found {
+			return ErrNotFound
+		}
+	}
+	return nil
+}
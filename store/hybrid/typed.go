@@ -0,0 +1,132 @@
+package hybrid
+
+import "context"
+
+// Map - a typed wrapper around HybridMap encoding keys and values with the configured codecs
+type Map[K comparable, V any] struct {
+	hm         *HybridMap
+	keyCodec   Codec
+	valueCodec Codec
+}
+
+// NewMap creates a new HybridMap with the given options and wraps it into a typed Map.
+// Nil codecs are replaced by defaults: RawCodec for string or []byte types, JSONCodec otherwise
+func NewMap[K comparable, V any](options Options, keyCodec, valueCodec Codec) (*Map[K, V], error) {
+	hm, err := New(options)
+	if err != nil {
+		return nil, err
+	}
+	return Wrap[K, V](hm, keyCodec, valueCodec), nil
+}
+
+// Wrap an existing HybridMap into a typed Map
+func Wrap[K comparable, V any](hm *HybridMap, keyCodec, valueCodec Codec) *Map[K, V] {
+	if keyCodec == nil {
+		keyCodec = defaultCodec[K]()
+	}
+	if valueCodec == nil {
+		valueCodec = defaultCodec[V]()
+	}
+	return &Map[K, V]{
+		hm:         hm,
+		keyCodec:   keyCodec,
+		valueCodec: valueCodec,
+	}
+}
+
+func defaultCodec[T any]() Codec {
+	var t T
+	switch any(t).(type) {
+	case string, []byte:
+		return RawCodec
+	default:
+		return JSONCodec
+	}
+}
+
+// HybridMap returns the underlying untyped map
+func (m *Map[K, V]) HybridMap() *HybridMap {
+	return m.hm
+}
+
+// Close the underlying map
+func (m *Map[K, V]) Close() error {
+	return m.hm.Close()
+}
+
+// Set - encodes and stores the value for the given key
+func (m *Map[K, V]) Set(k K, v V) error {
+	key, err := m.keyCodec.Marshal(k)
+	if err != nil {
+		return err
+	}
+	value, err := m.valueCodec.Marshal(v)
+	if err != nil {
+		return err
+	}
+	return m.hm.Set(string(key), value)
+}
+
+// Get - fetches and decodes the value for the given key
+func (m *Map[K, V]) Get(k K) (V, bool, error) {
+	var v V
+	key, err := m.keyCodec.Marshal(k)
+	if err != nil {
+		return v, false, err
+	}
+	data, ok := m.hm.Get(string(key))
+	if !ok {
+		return v, false, nil
+	}
+	if err := m.valueCodec.Unmarshal(data, &v); err != nil {
+		return v, false, err
+	}
+	return v, true, nil
+}
+
+// Del - removes the key from the map
+func (m *Map[K, V]) Del(k K) error {
+	key, err := m.keyCodec.Marshal(k)
+	if err != nil {
+		return err
+	}
+	return m.hm.Del(string(key))
+}
+
+// Scan - iterate over the whole map yielding decoded keys and values. Iteration stops
+// at the first error returned by f, by the codecs or by the disk store, which is then returned
+func (m *Map[K, V]) Scan(f func(K, V) error) error {
+	return m.hm.ScanContext(context.Background(), ScanOptions{Handler: func(kb, vb []byte) error {
+		var (
+			k K
+			v V
+		)
+		if err := m.keyCodec.Unmarshal(kb, &k); err != nil {
+			return err
+		}
+		if err := m.valueCodec.Unmarshal(vb, &v); err != nil {
+			return err
+		}
+		return f(k, v)
+	}})
+}
+
+// Len - returns the number of live keys
+func (m *Map[K, V]) Len() int64 {
+	return m.hm.Len()
+}
+
+// DiskBytes - returns the size of the disk store files
+func (m *Map[K, V]) DiskBytes() int64 {
+	return m.hm.DiskBytes()
+}
+
+// Stats - returns the statistics of the underlying map
+func (m *Map[K, V]) Stats() Stats {
+	return m.hm.Stats()
+}
+
+// Counters - returns the statistics of the underlying map without counting its items
+func (m *Map[K, V]) Counters() Stats {
+	return m.hm.Counters()
+}